@@ -0,0 +1,160 @@
+/*
+    access log module - one line per request in Combined Log Format or JSON, written separately from the application log
+
+    Use globally via `module.RegisterRequest( accesslog.New( os.Stdout, accesslog.Combined ) )` or per router via `Logger.Middleware`
+
+    (c)copyright 2021 by Gerald Wodni <gerald.wodni@gmail.com>
+*/
+package accesslog
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "io"
+    "net"
+    "net/http"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/GeraldWodni/kern.go/log"
+    "github.com/GeraldWodni/kern.go/router"
+    "github.com/GeraldWodni/kern.go/session"
+)
+
+type Format int
+const (
+    // Apache/nginx combined format, followed by the quoted request id
+    Combined Format = iota
+    // one JSON object per line, see `Entry`
+    JSON
+)
+
+// Logged per request
+type Entry struct {
+    Time time.Time          `json:"time"`
+    RemoteAddr string       `json:"remoteAddr"`
+    Username string         `json:"username,omitempty"`
+    Method string           `json:"method"`
+    URI string              `json:"uri"`
+    Proto string            `json:"proto"`
+    Status int              `json:"status"`
+    Bytes int64             `json:"bytes"`
+    Duration time.Duration  `json:"-"`
+    DurationMs float64      `json:"durationMs"`
+    Referer string          `json:"referer,omitempty"`
+    UserAgent string        `json:"userAgent,omitempty"`
+    RequestId string        `json:"requestId,omitempty"`
+}
+
+// Writes access log lines to `Writer`, safe for concurrent requests
+type Logger struct {
+    Writer io.Writer
+    Format Format
+    mutex sync.Mutex
+}
+
+// Access logger writing `format` lines to `writer`, i.e. `os.Stdout` or a log file
+func New( writer io.Writer, format Format ) *Logger {
+    return &Logger{
+        Writer: writer,
+        Format: format,
+    }
+}
+
+type contextType int; const startContextId = contextType(42) // internal context key
+
+// collect entry after `req` has been served, `res` must be (or wrap) a `router.StatusWriter`
+func newEntry( res http.ResponseWriter, req *http.Request, start time.Time ) (entry Entry) {
+    entry = Entry{
+        Time: start,
+        RemoteAddr: req.RemoteAddr,
+        Method: router.OriginalMethod( req ),
+        URI: req.RequestURI,
+        Proto: req.Proto,
+        Status: http.StatusOK,
+        Duration: time.Since( start ),
+        Referer: req.Referer(),
+        UserAgent: req.UserAgent(),
+        RequestId: router.RequestId( req ),
+    }
+    entry.DurationMs = float64( entry.Duration.Microseconds() ) / 1000
+    if host, _, err := net.SplitHostPort( req.RemoteAddr ); err == nil {
+        entry.RemoteAddr = host
+    }
+    if entry.URI == "" {
+        entry.URI = req.URL.RequestURI()
+    }
+    if statusWriter, ok := router.StatusOf( res ); ok {
+        if statusWriter.Status != 0 {
+            entry.Status = statusWriter.Status
+        }
+        entry.Bytes = statusWriter.Bytes
+    }
+    if s, ok := session.Of( req ); ok && s.LoggedIn {
+        entry.Username = s.Username
+    }
+    return
+}
+
+// `-` for empty fields
+func dash( value string ) string {
+    if value == "" {
+        return "-"
+    }
+    return value
+}
+
+// Line in Combined Log Format, the request id is appended as an additional quoted field
+func (entry Entry) Combined() string {
+    bytes := "-"
+    if entry.Bytes > 0 {
+        bytes = strconv.FormatInt( entry.Bytes, 10 )
+    }
+    return fmt.Sprintf( `%s - %s [%s] "%s %s %s" %d %s %s %s %s`,
+        entry.RemoteAddr, dash( entry.Username ), entry.Time.Format( "02/Jan/2006:15:04:05 -0700" ),
+        entry.Method, entry.URI, entry.Proto, entry.Status, bytes,
+        strconv.Quote( dash( entry.Referer ) ), strconv.Quote( dash( entry.UserAgent ) ), strconv.Quote( dash( entry.RequestId ) ) )
+}
+
+func (logger *Logger) write( req *http.Request, entry Entry ) {
+    var line string
+    if logger.Format == JSON {
+        data, err := json.Marshal( entry )
+        if err != nil {
+            log.Of( req ).Error( "accesslog:", err )
+            return
+        }
+        line = string( data )
+    } else {
+        line = entry.Combined()
+    }
+
+    logger.mutex.Lock()
+    defer logger.mutex.Unlock()
+    if _, err := io.WriteString( logger.Writer, strings.TrimRight( line, "\n" ) + "\n" ); err != nil {
+        log.Of( req ).Error( "accesslog:", err )
+    }
+}
+
+// Log all requests served by a router, i.e. `app.Router.Use( logger.Middleware )`
+func (logger *Logger) Middleware( res http.ResponseWriter, req *http.Request, next router.MiddlewareNext ) {
+    start := time.Now()
+    statusWriter := router.NewStatusWriter( res )
+    next( statusWriter, req )
+    logger.write( req, newEntry( statusWriter, req, start ) )
+}
+
+// implement module.Request interface to log all requests
+func (logger *Logger) StartRequest(res http.ResponseWriter, reqIn *http.Request) (reqOut *http.Request, ok bool) {
+    return reqIn.WithContext( context.WithValue( reqIn.Context(), startContextId, time.Now() ) ), true
+}
+func (logger *Logger) EndRequest(res http.ResponseWriter, req *http.Request) {
+    start, ok := req.Context().Value( startContextId ).(time.Time)
+    if !ok {
+        start = time.Now()
+    }
+    logger.write( req, newEntry( res, req, start ) )
+}
@@ -0,0 +1,61 @@
+package accesslog
+
+import (
+    "bytes"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+
+    "github.com/GeraldWodni/kern.go/log"
+    "github.com/GeraldWodni/kern.go/router"
+)
+
+// unmatched requests are logged with the status of their error page
+func TestMiddlewareStatus( t *testing.T ) {
+    output := &bytes.Buffer{}
+    logger := New( output, JSON )
+    r := router.New( "/" )
+    r.Use( logger.Middleware )
+    r.Get( "/x", func( res http.ResponseWriter, req *http.Request, next router.RouteNext ) {
+        res.Write( []byte( "found" ) )
+    })
+
+    for _, c := range []struct{ method, path string; status int }{
+        { http.MethodGet, "/x", http.StatusOK },
+        { http.MethodGet, "/missing", http.StatusNotFound },
+        { http.MethodDelete, "/x", http.StatusMethodNotAllowed },
+        { http.MethodOptions, "/x", http.StatusNoContent },
+    } {
+        output.Reset()
+        res := httptest.NewRecorder()
+        r.ServeHTTP( res, httptest.NewRequest( c.method, c.path, nil ) )
+        var entry Entry
+        if err := json.Unmarshal( output.Bytes(), &entry ); err != nil {
+            t.Fatalf( "%s %s: %s in %q", c.method, c.path, err, output.String() )
+        }
+        if res.Code != c.status || entry.Status != c.status || entry.Method != c.method || entry.URI != c.path {
+            t.Errorf( "%s %s: served %d, logged %+v, expected %d", c.method, c.path, res.Code, entry, c.status )
+        }
+        if int( entry.Bytes ) != res.Body.Len() {
+            t.Errorf( "%s %s: logged %d bytes, served %d", c.method, c.path, entry.Bytes, res.Body.Len() )
+        }
+    }
+}
+
+func TestCombined( t *testing.T ) {
+    output := &bytes.Buffer{}
+    logger := New( output, Combined )
+    r := router.New( "/" )
+    r.Use( logger.Middleware )
+    req := httptest.NewRequest( http.MethodGet, "/missing?q=1", nil )
+    req.Header.Set( "User-Agent", "test" )
+    res := httptest.NewRecorder()
+    r.ServeHTTP( res, req )
+
+    // `session` loads the `requestid` module
+    expected := `"GET /missing?q=1 HTTP/1.1" 404 `
+    if line := output.String(); !bytes.Contains( output.Bytes(), []byte( expected ) ) || !bytes.HasSuffix( output.Bytes(), []byte( `"-" "test" "` + res.Header().Get( log.RequestIdHeader ) + `"` + "\n" ) ) {
+        t.Fatalf( "line %q, expected %q", line, expected )
+    }
+}
@@ -0,0 +1,190 @@
+/*
+    cross-origin resource sharing - answers preflight requests and decorates responses for allowed origins
+
+    Use per router via `Policy.Middleware` or globally via `module.RegisterRequest( policy )`
+
+    (c)copyright 2021 by Gerald Wodni <gerald.wodni@gmail.com>
+*/
+package cors
+
+import (
+    "fmt"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/GeraldWodni/kern.go/router"
+)
+
+// Methods allowed when `Policy.Methods` is empty
+var DefaultMethods = []string{ http.MethodGet, http.MethodHead, http.MethodPost }
+
+// CORS policy, i.e.
+//     api.Use( (&cors.Policy{ Origins: []string{ "https://*.example.com" }, Methods: []string{ "GET", "PUT" }, Credentials: true }).Middleware )
+type Policy struct {
+    // exact origins like `https://ui.example.com`, subdomain wildcards like `https://*.example.com` or `*` for all
+    Origins []string
+    // methods allowed for cross-origin requests, `DefaultMethods` if empty
+    Methods []string
+    // request headers clients may send, `*` allows all
+    Headers []string
+    // response headers exposed to scripts
+    ExposeHeaders []string
+    // allow cookies and authorization headers, never for origins only allowed via `*`
+    Credentials bool
+    // how long clients may cache preflight results
+    MaxAge time.Duration
+}
+
+// Check if `origin` matches one of the policy's `Origins`
+func (policy *Policy) AllowsOrigin( origin string ) bool {
+    for _, pattern := range policy.Origins {
+        if pattern == "*" || matchesOrigin( pattern, origin ) {
+            return true
+        }
+    }
+    return false
+}
+
+// check if `origin` is allowed by a pattern other than `*`
+func (policy *Policy) listsOrigin( origin string ) bool {
+    for _, pattern := range policy.Origins {
+        if pattern != "*" && matchesOrigin( pattern, origin ) {
+            return true
+        }
+    }
+    return false
+}
+
+func matchesOrigin( pattern string, origin string ) bool {
+    if strings.EqualFold( pattern, origin ) {
+        return true
+    }
+    prefix, suffix, wildcard := strings.Cut( strings.ToLower( pattern ), "*" )
+    lowerOrigin := strings.ToLower( origin )
+    if wildcard && len( lowerOrigin ) > len( prefix ) + len( suffix ) &&
+        strings.HasPrefix( lowerOrigin, prefix ) && strings.HasSuffix( lowerOrigin, suffix ) {
+        // wildcard covers subdomains only, no ports or paths
+        middle := lowerOrigin[ len( prefix ):len( lowerOrigin ) - len( suffix ) ]
+        return !strings.ContainsAny( middle, ":/" )
+    }
+    return false
+}
+
+func (policy *Policy) methods() []string {
+    if len( policy.Methods ) == 0 {
+        return DefaultMethods
+    }
+    return policy.Methods
+}
+
+func (policy *Policy) allowsMethod( method string ) bool {
+    for _, allowed := range policy.methods() {
+        if strings.EqualFold( allowed, method ) {
+            return true
+        }
+    }
+    return false
+}
+
+func (policy *Policy) allowsHeaders( requested []string ) bool {
+    for _, header := range requested {
+        allowed := false
+        for _, pattern := range policy.Headers {
+            if pattern == "*" || strings.EqualFold( pattern, header ) {
+                allowed = true
+                break
+            }
+        }
+        if !allowed {
+            return false
+        }
+    }
+    return true
+}
+
+func (policy *Policy) allowOrigin( header http.Header, origin string ) {
+    // `*` cannot be combined with credentials: origins only allowed via `*` get it without them, any origin is never reflected
+    if !policy.listsOrigin( origin ) {
+        header.Set( "Access-Control-Allow-Origin", "*" )
+        if len( policy.Origins ) > 1 {
+            router.AddVary( header, "Origin" )
+        }
+        return
+    }
+    header.Set( "Access-Control-Allow-Origin", origin )
+    router.AddVary( header, "Origin" )
+    if policy.Credentials {
+        header.Set( "Access-Control-Allow-Credentials", "true" )
+    }
+}
+
+// Decorate response for cross-origin requests, preflight requests are answered and return true
+func (policy *Policy) Handle( res http.ResponseWriter, req *http.Request ) (handled bool) {
+    origin := req.Header.Get( "Origin" )
+    if origin == "" {
+        return false
+    }
+    header := res.Header()
+    requestMethod := req.Header.Get( "Access-Control-Request-Method" )
+    if req.Method != http.MethodOptions || requestMethod == "" {
+        if policy.AllowsOrigin( origin ) {
+            policy.allowOrigin( header, origin )
+            if len( policy.ExposeHeaders ) > 0 {
+                header.Set( "Access-Control-Expose-Headers", strings.Join( policy.ExposeHeaders, ", " ) )
+            }
+        } else {
+            router.AddVary( header, "Origin" )
+        }
+        return false
+    }
+
+    // preflight
+    for _, name := range []string{ "Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers" } {
+        router.AddVary( header, name )
+    }
+    requestHeaders := []string{}
+    for _, name := range strings.Split( req.Header.Get( "Access-Control-Request-Headers" ), "," ) {
+        if name = strings.TrimSpace( name ); name != "" {
+            requestHeaders = append( requestHeaders, name )
+        }
+    }
+    switch {
+        case !policy.AllowsOrigin( origin ):
+            router.Error( res, req, http.StatusForbidden, fmt.Errorf( "CORS: origin %s not allowed", origin ) )
+            return true
+        case !policy.allowsMethod( requestMethod ):
+            router.Error( res, req, http.StatusForbidden, fmt.Errorf( "CORS: method %s not allowed", requestMethod ) )
+            return true
+        case !policy.allowsHeaders( requestHeaders ):
+            router.Error( res, req, http.StatusForbidden, fmt.Errorf( "CORS: headers %s not allowed", strings.Join( requestHeaders, ", " ) ) )
+            return true
+    }
+
+    policy.allowOrigin( header, origin )
+    header.Set( "Access-Control-Allow-Methods", strings.Join( policy.methods(), ", " ) )
+    if len( requestHeaders ) > 0 {
+        // echo instead of `*`, which browsers ignore for credentialed requests
+        header.Set( "Access-Control-Allow-Headers", strings.Join( requestHeaders, ", " ) )
+    }
+    if policy.MaxAge > 0 {
+        header.Set( "Access-Control-Max-Age", strconv.Itoa( int( policy.MaxAge.Seconds() ) ) )
+    }
+    res.WriteHeader( http.StatusNoContent )
+    return true
+}
+
+// Apply policy to all routes of a router, i.e. `apiRouter.Use( policy.Middleware )`
+func (policy *Policy) Middleware( res http.ResponseWriter, req *http.Request, next router.MiddlewareNext ) {
+    if !policy.Handle( res, req ) {
+        next( res, req )
+    }
+}
+
+// implement module.Request interface to apply policy to all requests
+func (policy *Policy) StartRequest(res http.ResponseWriter, reqIn *http.Request) (reqOut *http.Request, ok bool) {
+    return reqIn, !policy.Handle( res, reqIn )
+}
+func (policy *Policy) EndRequest(res http.ResponseWriter, req *http.Request) {
+}
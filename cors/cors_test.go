@@ -0,0 +1,43 @@
+package cors
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "testing"
+)
+
+// `*` is never combined with credentials, listed origins still receive them
+func TestWildcardWithCredentials( t *testing.T ) {
+    policy := &Policy{ Origins: []string{ "*", "https://ui.example.com" }, Credentials: true }
+    for _, c := range []struct{ origin, allowOrigin, credentials string }{
+        { "https://evil.example.org", "*", "" },
+        { "https://ui.example.com", "https://ui.example.com", "true" },
+    } {
+        for _, method := range []string{ http.MethodGet, http.MethodOptions } {
+            req := httptest.NewRequest( method, "/", nil )
+            req.Header.Set( "Origin", c.origin )
+            if method == http.MethodOptions {
+                req.Header.Set( "Access-Control-Request-Method", http.MethodGet )
+            }
+            res := httptest.NewRecorder()
+            policy.Handle( res, req )
+            header := res.Header()
+            if header.Get( "Access-Control-Allow-Origin" ) != c.allowOrigin || header.Get( "Access-Control-Allow-Credentials" ) != c.credentials {
+                t.Errorf( "%s %s: Allow-Origin %q, Allow-Credentials %q", method, c.origin, header.Get( "Access-Control-Allow-Origin" ), header.Get( "Access-Control-Allow-Credentials" ) )
+            }
+            if header.Get( "Vary" ) == "" {
+                t.Errorf( "%s %s: no Vary header", method, c.origin )
+            }
+        }
+    }
+
+    // only `*`: same answer for every origin
+    policy = &Policy{ Origins: []string{ "*" }, Credentials: true }
+    req := httptest.NewRequest( http.MethodGet, "/", nil )
+    req.Header.Set( "Origin", "https://evil.example.org" )
+    res := httptest.NewRecorder()
+    policy.Handle( res, req )
+    if header := res.Header(); header.Get( "Access-Control-Allow-Origin" ) != "*" || header.Get( "Access-Control-Allow-Credentials" ) != "" || header.Get( "Vary" ) != "" {
+        t.Errorf( "only *: headers %v", header )
+    }
+}
@@ -0,0 +1,90 @@
+/*
+    debug - lists all routes of a router tree, including mounted routers, as HTML table or JSON
+
+    __Hint:__ only mount this in development, it reveals the complete structure of an app.
+
+    (c)copyright 2021 by Gerald Wodni <gerald.wodni@gmail.com>
+*/
+package debug
+
+import (
+    "encoding/json"
+    "html/template"
+    "net/http"
+
+    "github.com/GeraldWodni/kern.go/log"
+    "github.com/GeraldWodni/kern.go/router"
+    "github.com/GeraldWodni/kern.go/security"
+)
+
+var routesTemplate = template.Must( template.New( "routes" ).Parse( `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <title>Routes</title>
+    <style{{with .Nonce}} nonce="{{.}}"{{end}}>
+        table { border-collapse: collapse; font-family: monospace; }
+        th, td { border: 1px solid #999; padding: 2px 5px; text-align: left; }
+        .mount { background-color: #EEE; }
+    </style>
+</head>
+<body>
+    <h1>Routes</h1>
+    <table>
+        <tr><th>Router</th><th>Method</th><th>Path</th><th>Full path</th><th>Name</th><th>Handler</th></tr>
+        {{template "router" .Root}}
+    </table>
+</body>
+</html>
+{{define "router"}}
+    {{$router := .}}
+    {{range .Routes}}
+        <tr{{if .Mounted}} class="mount"{{end}}>
+            <td>{{$router.Name}} ({{$router.MountPoint}})</td>
+            <td>{{.Method}}</td>
+            <td>{{.Path}}</td>
+            <td>{{.FullPath}}</td>
+            <td>{{.Name}}</td>
+            <td>{{.Handler}}</td>
+        </tr>
+        {{if .Mounted}}{{template "router" .Mounted}}{{end}}
+    {{end}}
+{{end}}` ) )
+
+// Router listing all routes of `root` under `path`, use `path/routes.json` or `Accept: application/json` for JSON
+// Example:
+//     app.Router.Mount( debug.Routes( "/debug/routes", app.Router ) )
+func Routes( path string, root *router.Router ) (debugRouter *router.Router) {
+    debugRouter = router.New( path )
+    debugRouter.Name = "Debug"
+    debugRouter.Get( "/routes.json", func( res http.ResponseWriter, req *http.Request, next router.RouteNext ) {
+        renderJSON( res, req, root )
+    })
+    debugRouter.Get( "/", func( res http.ResponseWriter, req *http.Request, next router.RouteNext ) {
+        if router.PrefersJSON( req ) {
+            renderJSON( res, req, root )
+            return
+        }
+        res.Header().Set( "Content-Type", "text/html; charset=utf-8" )
+        // inline style is allowed by `security.Strict` via the request's nonce
+        data := struct{
+            Nonce string
+            Root router.RouterInfo
+        }{
+            Nonce: security.Nonce( req ),
+            Root: root.Describe(),
+        }
+        if err := routesTemplate.Execute( res, data ); err != nil {
+            log.Of( req ).Error( "debug.Routes:", err )
+        }
+    })
+    return
+}
+
+func renderJSON( res http.ResponseWriter, req *http.Request, root *router.Router ) {
+    res.Header().Set( "Content-Type", "application/json" )
+    encoder := json.NewEncoder( res )
+    encoder.SetIndent( "", "  " )
+    if err := encoder.Encode( root.Describe() ); err != nil {
+        log.Of( req ).Error( "debug.Routes:", err )
+    }
+}
@@ -0,0 +1,15 @@
+/*
+    kern.go's default views, css and images, embedded into every binary as the final `hierarchy` layer
+
+    (c)copyright 2021 by Gerald Wodni <gerald.wodni@gmail.com>
+*/
+package defaults
+
+import (
+    "embed"
+)
+
+// Files relative to this directory, i.e. `views/login.gohtml`
+// Hint: image sources like `.xcf` are not embedded
+//go:embed views css images/favicon.ico images/icons images/messages/*.png
+var FS embed.FS
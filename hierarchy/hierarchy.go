@@ -1,35 +1,59 @@
 /*
     Hierarchical lookup for pathes.
     Instead of a hardcoded path, a list of directories is traversed to allow for easy extension and subvolume-mounting.
+    kern.go's defaults are embedded as the final layer, so binaries work without a copy of `./default`.
 
     (c)copyright 2022 by Gerald Wodni <gerald.wodni@gmail.com>
 */
 package hierarchy
 
 import (
+    "io/fs"
     "path"
     "io/ioutil"
     "os"
+    "strings"
 
+    defaults "github.com/GeraldWodni/kern.go/default"
     "github.com/GeraldWodni/kern.go/log"
 )
 
+// On-disk defaults, appended to the prefixes when present, i.e. while working on kern.go itself
+const DefaultPrefix = "./default"
+
+// kern.go's default views, css and images embedded into the binary
+var Embedded fs.FS = defaults.FS
+
 type Hierarchy struct {
     Prefixes []string
+    // searched after all `Prefixes`, see `Find`
+    Fallback fs.FS
 }
 
-// Creates a new `Hierarchy` with a list of prefixes; hint: `default` is automatically appended.
-func New( prefixes []string ) (hierarchy *Hierarchy, err error) {
-    prefixes = append( prefixes, "./default" )
+// Hierarchy of kern.go's defaults only, i.e. for modules loading their views in `init`
+var Default = &Hierarchy{
+    Prefixes: defaultPrefixes( []string{} ),
+    Fallback: Embedded,
+}
 
+// Creates a new `Hierarchy` with a list of prefixes; hint: `./default` is appended if it exists and `Embedded` is the final layer.
+func New( prefixes []string ) (hierarchy *Hierarchy, err error) {
     hierarchy = &Hierarchy {
-        Prefixes: prefixes,
+        Prefixes: defaultPrefixes( prefixes ),
+        Fallback: Embedded,
     }
     err = hierarchy.init()
 
     return
 }
 
+func defaultPrefixes( prefixes []string ) []string {
+    if info, err := os.Stat( DefaultPrefix ); err == nil && info.IsDir() {
+        prefixes = append( prefixes, DefaultPrefix )
+    }
+    return prefixes
+}
+
 // check if all prefixes are readable directories to avoid later confusion
 func (hierarchy *Hierarchy)init() (err error) {
     for _, prefix := range hierarchy.Prefixes {
@@ -53,6 +77,7 @@ func (hierarchy *Hierarchy)LookupFatal( suffixes ...string ) (filename string) {
 }
 
 // lookup with optional fail
+// Hint: only searches `Prefixes` on disk, use `Find` to include `Fallback`
 func (hierarchy *Hierarchy)Lookup( suffixes ...string ) (filename string, ok bool) {
     suffix := path.Join( suffixes... )
     for _, prefix := range hierarchy.Prefixes {
@@ -65,6 +90,27 @@ func (hierarchy *Hierarchy)Lookup( suffixes ...string ) (filename string, ok boo
     return
 }
 
+// lookup in all `Prefixes`, then `Fallback`; `name` is relative to `fsys`, i.e. for `http.ServeContent` or `template.ParseFS`
+func (hierarchy *Hierarchy) Find( suffixes ...string ) (fsys fs.FS, name string, ok bool) {
+    // clean to a valid `fs.FS` name, `..` cannot escape the prefix
+    name = strings.TrimPrefix( path.Clean( "/" + path.Join( suffixes... ) ), "/" )
+    if name == "" {
+        name = "."
+    }
+    for _, prefix := range hierarchy.Prefixes {
+        fsys = os.DirFS( prefix )
+        if _, err := fs.Stat( fsys, name ); err == nil {
+            return fsys, name, true
+        }
+    }
+    if hierarchy.Fallback != nil {
+        if _, err := fs.Stat( hierarchy.Fallback, name ); err == nil {
+            return hierarchy.Fallback, name, true
+        }
+    }
+    return nil, "", false
+}
+
 func (hierarchy *Hierarchy) Exists( prefix string, suffix string ) (ok bool) {
     _, ok = hierarchy.LookupFile( prefix, suffix )
     return
@@ -83,6 +129,7 @@ func (hierarchy *Hierarchy) LookupFile( prefix string, suffix string ) (filename
 }
 
 // load contents of folder and allow hierarchical overwriting
+// Hint: only searches `Prefixes` on disk, files of `Fallback` have no filename
 func (hierarchy *Hierarchy) LookupDirectory( suffixes ...string ) (filenames []string, ok bool) {
     suffix := path.Join( suffixes... )
     filenames = []string{}
@@ -0,0 +1,459 @@
+/*
+    redistest - in-memory stand-in speaking the redis protocol, so tests of redis users run without a server
+
+    Supports the commands used by kern.go: strings, counters, expiry, lists, hashes, transactions and pub/sub.
+    Lua scripts cannot run, register a Go emulation via `Server.Script` instead.
+
+    (c)copyright 2021 by Gerald Wodni <gerald.wodni@gmail.com>
+*/
+package redistest
+
+import (
+    "bufio"
+    "crypto/sha1"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "io"
+    "net"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+)
+
+// Status reply like `OK`, plain strings are sent as bulk strings
+type Status string
+
+// Emulation of a Lua script, `call` runs a command like `redis.call` does
+type Script func( call func( command string, args ...string ) (interface{}, error), keys []string, argv []string ) (interface{}, error)
+
+type Server struct {
+    listener net.Listener
+    mutex sync.Mutex
+    strings map[string]string
+    lists map[string][]string
+    hashes map[string]map[string]string
+    expires map[string]time.Time
+    // by channel
+    subscribers map[string]map[*client]bool
+    // by sha1 of their source
+    scripts map[string]Script
+    clients map[*client]bool
+}
+
+type client struct {
+    conn net.Conn
+    writeMutex sync.Mutex
+    channels map[string]bool
+}
+
+// Start stand-in on a free local port, see `Addr`
+func Start() (server *Server, err error) {
+    listener, err := net.Listen( "tcp", "127.0.0.1:0" )
+    if err != nil {
+        return
+    }
+    server = &Server{
+        listener: listener,
+        strings: make(map[string]string),
+        lists: make(map[string][]string),
+        hashes: make(map[string]map[string]string),
+        expires: make(map[string]time.Time),
+        subscribers: make(map[string]map[*client]bool),
+        scripts: make(map[string]Script),
+        clients: make(map[*client]bool),
+    }
+    go server.accept()
+    return
+}
+
+// Address to dial, i.e. for `redis.Address`
+func (server *Server) Addr() string {
+    return server.listener.Addr().String()
+}
+
+// Stop accepting and drop all connections
+func (server *Server) Close() {
+    server.listener.Close()
+    server.DropConnections()
+}
+
+// Close all client connections like a restarting server, data is kept
+func (server *Server) DropConnections() {
+    server.mutex.Lock()
+    defer server.mutex.Unlock()
+    for c := range server.clients {
+        c.conn.Close()
+    }
+}
+
+// Number of connections subscribed to `channel`
+func (server *Server) Subscribers( channel string ) int {
+    server.mutex.Lock()
+    defer server.mutex.Unlock()
+    return len( server.subscribers[ channel ] )
+}
+
+// Answer `EVAL` and `EVALSHA` of `source` with `script`
+func (server *Server) Script( source string, script Script ) {
+    server.mutex.Lock()
+    defer server.mutex.Unlock()
+    server.scripts[ sha( source ) ] = script
+}
+
+func sha( source string ) string {
+    sum := sha1.Sum( []byte( source ) )
+    return hex.EncodeToString( sum[:] )
+}
+
+func (server *Server) accept() {
+    for {
+        conn, err := server.listener.Accept()
+        if err != nil {
+            return
+        }
+        c := &client{ conn: conn, channels: make(map[string]bool) }
+        server.mutex.Lock()
+        server.clients[ c ] = true
+        server.mutex.Unlock()
+        go server.serve( c )
+    }
+}
+
+func (server *Server) serve( c *client ) {
+    defer func() {
+        server.mutex.Lock()
+        defer server.mutex.Unlock()
+        for channel := range c.channels {
+            delete( server.subscribers[ channel ], c )
+        }
+        delete( server.clients, c )
+        c.conn.Close()
+    }()
+
+    reader := bufio.NewReader( c.conn )
+    var queued [][]string
+    multi := false
+    for {
+        args, err := readCommand( reader )
+        if err != nil {
+            return
+        }
+        if len( args ) == 0 {
+            continue
+        }
+        command := strings.ToUpper( args[0] )
+        switch {
+            case command == "MULTI":
+                multi = true
+                c.write( Status( "OK" ) )
+            case command == "DISCARD":
+                multi, queued = false, nil
+                c.write( Status( "OK" ) )
+            case command == "EXEC":
+                // all queued commands run under one lock, like redis runs transactions
+                server.mutex.Lock()
+                replies := []interface{}{}
+                for _, queuedArgs := range queued {
+                    reply, err := server.exec( queuedArgs )
+                    if err != nil {
+                        reply = err
+                    }
+                    replies = append( replies, reply )
+                }
+                server.mutex.Unlock()
+                multi, queued = false, nil
+                c.write( replies )
+            case multi:
+                queued = append( queued, args )
+                c.write( Status( "QUEUED" ) )
+            case command == "SUBSCRIBE":
+                server.subscribe( c, args[1:] )
+            case command == "UNSUBSCRIBE":
+                server.unsubscribe( c, args[1:] )
+            default:
+                server.mutex.Lock()
+                reply, err := server.exec( args )
+                server.mutex.Unlock()
+                if err != nil {
+                    reply = err
+                }
+                c.write( reply )
+        }
+    }
+}
+
+func (server *Server) subscribe( c *client, channels []string ) {
+    server.mutex.Lock()
+    defer server.mutex.Unlock()
+    for _, channel := range channels {
+        if server.subscribers[ channel ] == nil {
+            server.subscribers[ channel ] = make(map[*client]bool)
+        }
+        server.subscribers[ channel ][ c ] = true
+        c.channels[ channel ] = true
+        c.write( []interface{}{ "subscribe", channel, int64( len( c.channels ) ) } )
+    }
+}
+
+func (server *Server) unsubscribe( c *client, channels []string ) {
+    server.mutex.Lock()
+    defer server.mutex.Unlock()
+    if len( channels ) == 0 {
+        for channel := range c.channels {
+            channels = append( channels, channel )
+        }
+    }
+    for _, channel := range channels {
+        delete( server.subscribers[ channel ], c )
+        delete( c.channels, channel )
+        c.write( []interface{}{ "unsubscribe", channel, int64( len( c.channels ) ) } )
+    }
+}
+
+// run a single command, `server.mutex` must be held
+func (server *Server) exec( args []string ) (reply interface{}, err error) {
+    command := strings.ToUpper( args[0] )
+    args = args[1:]
+    arity := map[string]int{
+        "PING": 0, "GET": 1, "SET": 2, "DEL": 1, "INCR": 1, "PEXPIRE": 2, "EXPIRE": 2,
+        "HSET": 3, "HMSET": 3, "HGETALL": 1, "RPUSH": 2, "LTRIM": 3, "LRANGE": 3,
+        "PUBLISH": 2, "EVAL": 2, "EVALSHA": 2, "SCRIPT": 1,
+    }
+    required, known := arity[ command ]
+    if !known {
+        return nil, fmt.Errorf( "ERR unknown command '%s'", command )
+    }
+    if len( args ) < required {
+        return nil, fmt.Errorf( "ERR wrong number of arguments for '%s' command", command )
+    }
+    for _, key := range args[:min( 1, len( args ) )] {
+        server.expire( key )
+    }
+
+    switch command {
+        case "PING":
+            return Status( "PONG" ), nil
+        case "GET":
+            if value, ok := server.strings[ args[0] ]; ok {
+                return value, nil
+            }
+            return nil, nil
+        case "SET":
+            server.strings[ args[0] ] = args[1]
+            delete( server.expires, args[0] )
+            return Status( "OK" ), nil
+        case "DEL":
+            var deleted int64
+            for _, key := range args {
+                server.expire( key )
+                if server.exists( key ) {
+                    deleted++
+                }
+                server.delete( key )
+            }
+            return deleted, nil
+        case "INCR":
+            value, _ := strconv.ParseInt( server.strings[ args[0] ], 10, 64 )
+            value++
+            server.strings[ args[0] ] = strconv.FormatInt( value, 10 )
+            return value, nil
+        case "PEXPIRE", "EXPIRE":
+            timeout, err := strconv.ParseInt( args[1], 10, 64 )
+            if err != nil {
+                return nil, errors.New( "ERR value is not an integer or out of range" )
+            }
+            if !server.exists( args[0] ) {
+                return int64( 0 ), nil
+            }
+            unit := time.Millisecond
+            if command == "EXPIRE" {
+                unit = time.Second
+            }
+            server.expires[ args[0] ] = time.Now().Add( time.Duration( timeout ) * unit )
+            return int64( 1 ), nil
+        case "HSET", "HMSET":
+            hash := server.hashes[ args[0] ]
+            if hash == nil {
+                hash = make(map[string]string)
+                server.hashes[ args[0] ] = hash
+            }
+            for i := 1; i + 1 < len( args ); i += 2 {
+                hash[ args[i] ] = args[i+1]
+            }
+            if command == "HMSET" {
+                return Status( "OK" ), nil
+            }
+            return int64( len( args ) / 2 ), nil
+        case "HGETALL":
+            fields := []interface{}{}
+            for name, value := range server.hashes[ args[0] ] {
+                fields = append( fields, name, value )
+            }
+            return fields, nil
+        case "RPUSH":
+            server.lists[ args[0] ] = append( server.lists[ args[0] ], args[1:]... )
+            return int64( len( server.lists[ args[0] ] ) ), nil
+        case "LTRIM", "LRANGE":
+            list := server.lists[ args[0] ]
+            start, stop, ok := listRange( len( list ), args[1], args[2] )
+            if !ok {
+                return nil, errors.New( "ERR value is not an integer or out of range" )
+            }
+            if command == "LTRIM" {
+                server.lists[ args[0] ] = append( []string{}, list[start:stop]... )
+                return Status( "OK" ), nil
+            }
+            items := []interface{}{}
+            for _, item := range list[start:stop] {
+                items = append( items, item )
+            }
+            return items, nil
+        case "PUBLISH":
+            var received int64
+            for subscriber := range server.subscribers[ args[0] ] {
+                subscriber.write( []interface{}{ "message", args[0], args[1] } )
+                received++
+            }
+            return received, nil
+        case "SCRIPT":
+            if strings.ToUpper( args[0] ) == "LOAD" && len( args ) > 1 {
+                return sha( args[1] ), nil
+            }
+            return nil, errors.New( "ERR unsupported SCRIPT subcommand" )
+        case "EVAL", "EVALSHA":
+            hash := args[0]
+            if command == "EVAL" {
+                hash = sha( args[0] )
+            }
+            script, ok := server.scripts[ hash ]
+            if !ok {
+                if command == "EVAL" {
+                    return nil, errors.New( "ERR script not emulated, see redistest.Server.Script" )
+                }
+                return nil, errors.New( "NOSCRIPT No matching script. Please use EVAL." )
+            }
+            numKeys, err := strconv.Atoi( args[1] )
+            if err != nil || numKeys < 0 || numKeys > len( args ) - 2 {
+                return nil, errors.New( "ERR Number of keys can't be greater than number of args" )
+            }
+            call := func( command string, callArgs ...string ) (interface{}, error) {
+                return server.exec( append( []string{ command }, callArgs... ) )
+            }
+            return script( call, args[2:2+numKeys], args[2+numKeys:] )
+    }
+    return nil, nil
+}
+
+func (server *Server) exists( key string ) bool {
+    _, isString := server.strings[ key ]
+    _, isList := server.lists[ key ]
+    _, isHash := server.hashes[ key ]
+    return isString || isList || isHash
+}
+
+func (server *Server) delete( key string ) {
+    delete( server.strings, key )
+    delete( server.lists, key )
+    delete( server.hashes, key )
+    delete( server.expires, key )
+}
+
+// drop `key` once its deadline passed
+func (server *Server) expire( key string ) {
+    if deadline, ok := server.expires[ key ]; ok && !time.Now().Before( deadline ) {
+        server.delete( key )
+    }
+}
+
+// redis style inclusive range with negative indices, as slice bounds
+func listRange( length int, startArg string, stopArg string ) (start int, stop int, ok bool) {
+    start, startErr := strconv.Atoi( startArg )
+    stop, stopErr := strconv.Atoi( stopArg )
+    if startErr != nil || stopErr != nil {
+        return 0, 0, false
+    }
+    if start < 0 {
+        start += length
+    }
+    if stop < 0 {
+        stop += length
+    }
+    start = max( 0, start )
+    stop = min( length - 1, stop ) + 1
+    if start >= stop {
+        return 0, 0, true
+    }
+    return start, stop, true
+}
+
+// read one command sent as array of bulk strings
+func readCommand( reader *bufio.Reader ) (args []string, err error) {
+    line, err := readLine( reader )
+    if err != nil {
+        return
+    }
+    if !strings.HasPrefix( line, "*" ) {
+        // inline command, i.e. typed via telnet
+        return strings.Fields( line ), nil
+    }
+    count, err := strconv.Atoi( line[1:] )
+    if err != nil {
+        return
+    }
+    for i := 0; i < count; i++ {
+        header, err := readLine( reader )
+        if err != nil {
+            return nil, err
+        }
+        if !strings.HasPrefix( header, "$" ) {
+            return nil, fmt.Errorf( "redistest: expected bulk string, got %q", header )
+        }
+        length, err := strconv.Atoi( header[1:] )
+        if err != nil {
+            return nil, err
+        }
+        data := make([]byte, length + 2)
+        if _, err := io.ReadFull( reader, data ); err != nil {
+            return nil, err
+        }
+        args = append( args, string( data[:length] ) )
+    }
+    return
+}
+
+func readLine( reader *bufio.Reader ) (string, error) {
+    line, err := reader.ReadString( '\n' )
+    return strings.TrimRight( line, "\r\n" ), err
+}
+
+func (c *client) write( reply interface{} ) {
+    c.writeMutex.Lock()
+    defer c.writeMutex.Unlock()
+    c.conn.Write( encode( reply ) )
+}
+
+func encode( reply interface{} ) []byte {
+    switch reply := reply.(type) {
+        case nil:
+            return []byte( "$-1\r\n" )
+        case Status:
+            return []byte( "+" + string( reply ) + "\r\n" )
+        case error:
+            return []byte( "-" + reply.Error() + "\r\n" )
+        case int64:
+            return []byte( ":" + strconv.FormatInt( reply, 10 ) + "\r\n" )
+        case int:
+            return []byte( ":" + strconv.Itoa( reply ) + "\r\n" )
+        case string:
+            return []byte( "$" + strconv.Itoa( len( reply ) ) + "\r\n" + reply + "\r\n" )
+        case []interface{}:
+            data := []byte( "*" + strconv.Itoa( len( reply ) ) + "\r\n" )
+            for _, item := range reply {
+                data = append( data, encode( item )... )
+            }
+            return data
+    }
+    return encode( fmt.Errorf( "ERR redistest cannot encode %T", reply ) )
+}
@@ -7,6 +7,7 @@ package kern
 
 import (
     "net/http"
+    "time"
 
     "github.com/GeraldWodni/kern.go/hierarchy"
     "github.com/GeraldWodni/kern.go/log"
@@ -15,17 +16,24 @@ import (
 
     // import modules
     // Hint: use `_` when no direct interface is needed, so they are correctly registers as `module`
+    // Hint: modules register in package initialisation order, `session` imports `requestid` so the request id is assigned first
+    _ "github.com/GeraldWodni/kern.go/requestid"
     _ "github.com/GeraldWodni/kern.go/session"
 )
 
 type Kern struct {
+    // default router, serves all hosts without a matching `Website`
     Router *router.Router
     Hierarchy *hierarchy.Hierarchy
     BindAddr string
+    // keyed by host pattern, see `AddWebsite`
+    Websites map[string]*Website
 }
 
 // Kern instance hosted on `bindAddr`
-// Hint: mounts `/favicon.ico`, `/css`, `/js`, `/images`, `/files` from `/default/*`
+// Hint: mounts `/favicon.ico`, `/css`, `/js`, `/images`, `/files` from the hierarchy, falling back to the embedded `default/*`,
+// the directories are named routes, i.e. `{{url "css" "filepath" "index.css"}}`, as is the root `{{url "index"}}` rendering `views/index.gohtml`.
+// The default `index.gohtml` links to `{{url "logout"}}`, mount `logout.Logout` or provide your own
 func New( bindAddr string, hierarchyPrefixes []string ) (kern *Kern) {
 
     hierarchyInstance, err := hierarchy.New( hierarchyPrefixes )
@@ -34,31 +42,52 @@ func New( bindAddr string, hierarchyPrefixes []string ) (kern *Kern) {
     }
 
     kern = &Kern {
-        Router: router.New("/"),
+        Router: newRouter( "kern", hierarchyInstance ),
         Hierarchy: hierarchyInstance,
         BindAddr: bindAddr,
+        Websites: make(map[string]*Website),
     }
 
-    // Set router name for debugging
-    kern.Router.Name = "kern"
-
     // Set default globals
     view.Globals[ "AppPrefix" ] = "kern.go:"
     view.Globals[ "TitleSuffix" ] = " <- kern.go"
 
+    return
+}
+
+// Router with kern's default routes, static files are looked up in `hierarchyInstance`
+func newRouter( name string, hierarchyInstance *hierarchy.Hierarchy ) (kernRouter *router.Router) {
+    kernRouter = router.New("/")
+
+    // Set router name for debugging
+    kernRouter.Name = name
+
+    // compress text responses like views and css
+    kernRouter.Use( router.Compress )
+
     // activate modules via generic route
-    kern.Router.All( "/", func( res http.ResponseWriter, req *http.Request, next router.RouteNext ) {
+    kernRouter.All( "/", func( res http.ResponseWriter, req *http.Request, next router.RouteNext ) {
         // Log every call
-        log.SubSection( req.Method, req.URL )
+        log.Of( req ).SubSection( req.Method, req.URL )
         next()
     })
 
     // static routes go first
-    kern.Router.StaticFile( "/favicon.ico", "image/x-icon", "./default/images/favicon.ico" )
-    kern.Router.HierarchyDir( hierarchyInstance, "/css" )
-    kern.Router.HierarchyDir( hierarchyInstance, "/js" )
-    kern.Router.HierarchyDir( hierarchyInstance, "/images" )
-    kern.Router.HierarchyDir( hierarchyInstance, "./default/files"  )
+    kernRouter.HierarchyFile( hierarchyInstance, "/favicon.ico", "image/x-icon", "images/favicon.ico" )
+    kernRouter.HierarchyDir( hierarchyInstance, "/css" ).Name( "css" )
+    kernRouter.HierarchyDir( hierarchyInstance, "/js" ).Name( "js" )
+    kernRouter.HierarchyDir( hierarchyInstance, "/images" ).Name( "images" ).Cache( router.CachePolicy{ MaxAge: 24*time.Hour } )
+    kernRouter.HierarchyDir( hierarchyInstance, "/files" ).Name( "files" )
+
+    // website root renders `views/index.gohtml` of the website's hierarchy, named for links back home: `{{url "index"}}`
+    kernRouter.Get( "/", func( res http.ResponseWriter, req *http.Request, next router.RouteNext ) {
+        view.RenderNamed( res, req, http.StatusOK, "index", nil )
+    }).Exact().Name( "index" )
+
+    // Error pages i.e. catchall 404 at the end of routing: `views/errors/<status>.gohtml`
+    kernRouter.ErrorHandler = view.ErrorHandler( hierarchyInstance )
+    // views of `router.Resource` controllers, i.e. `views/items/index.gohtml`
+    kernRouter.Renderer = view.Renderer( hierarchyInstance )
 
     return
 }
@@ -67,18 +96,16 @@ func New( bindAddr string, hierarchyPrefixes []string ) (kern *Kern) {
 func (kern *Kern) Run() {
     log.Section("Starting kern.go")
 
-    // mount main router
-    http.Handle( "/", kern.Router )
+    // mount main router, dispatches websites by host
+    http.Handle( "/", kern )
 
-    // Catchall 404 at the end of routing
-    notFound, err := view.NewHtml( kern.Hierarchy.LookupFatal( "views", "errors/404.gohtml" ) )
-    if err != nil {
-        log.Error( err )
+    // run server, no write timeout as streams and websockets are long lived; use `Route.Timeout` for handlers
+    server := &http.Server{
+        Addr: kern.BindAddr,
+        ReadHeaderTimeout: 10 * time.Second,
+        IdleTimeout: 2 * time.Minute,
     }
-    kern.Router.NotFoundHandler = view.Handler( notFound )
-
-    // run server
-    if err := http.ListenAndServe(kern.BindAddr, nil); err != nil {
+    if err := server.ListenAndServe(); err != nil {
         log.Fatal( err )
     }
 
@@ -0,0 +1,31 @@
+package kern
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+
+    "github.com/GeraldWodni/kern.go/logout"
+)
+
+// the root renders the default index linking to the mounted logout, other paths are not served by it
+func TestIndexRoute( t *testing.T ) {
+    kern := New( ":0", []string{} )
+    kern.Router.Mount( logout.Logout( "/logout" ) )
+
+    res := httptest.NewRecorder()
+    kern.ServeHTTP( res, httptest.NewRequest( http.MethodGet, "/", nil ) )
+    if res.Code != http.StatusOK || !strings.Contains( res.Body.String(), `<a href="/logout">Logout</a>` ) {
+        t.Fatalf( "/: status %d, body %q", res.Code, res.Body.String() )
+    }
+    if path, err := kern.Router.URLFor( "index", nil ); path != "/" || err != nil {
+        t.Errorf( "index: %q, %v", path, err )
+    }
+
+    res = httptest.NewRecorder()
+    kern.ServeHTTP( res, httptest.NewRequest( http.MethodGet, "/missing", nil ) )
+    if res.Code != http.StatusNotFound {
+        t.Errorf( "/missing: status %d", res.Code )
+    }
+}
@@ -0,0 +1,80 @@
+/*
+    Request logger - prefixes lines with the id of the request being served, see the `requestid` module
+
+    Package-level functions like `log.Error` cannot know the request, code serving a request logs via `log.Of( req )`
+    as kern.go's routers, views and modules do; only helpers without a request like the `filter` functions log without id
+
+    (c)copyright 2021 by Gerald Wodni <gerald.wodni@gmail.com>
+*/
+package log
+
+import (
+    "context"
+    "net/http"
+)
+
+type contextType int; const requestIdContextId = contextType(42) // internal context key
+
+// Response header carrying the request id, set by the `requestid` module
+const RequestIdHeader = "X-Request-ID"
+
+// Store `requestId` for `Of`
+func WithRequestId( ctx context.Context, requestId string ) context.Context {
+    return context.WithValue( ctx, requestIdContextId, requestId )
+}
+
+// get request id stored via `WithRequestId`, empty if none
+func RequestIdOf( ctx context.Context ) string {
+    requestId, _ := ctx.Value( requestIdContextId ).(string)
+    return requestId
+}
+
+// Logger for lines emitted while serving a request
+type Logger struct {
+    prefix string
+}
+
+// get logger for `req`, i.e. `log.Of( req ).Error( err )` logs `[<request id>] <err>`
+func Of( req *http.Request ) Logger {
+    if requestId := RequestIdOf( req.Context() ); requestId != "" {
+        return Logger{ prefix: "[" + requestId + "]" }
+    }
+    return Logger{}
+}
+
+// get logger for code which only has the response, uses the request id echoed in its header
+func OfResponse( res http.ResponseWriter ) Logger {
+    if requestId := res.Header().Get( RequestIdHeader ); requestId != "" {
+        return Logger{ prefix: "[" + requestId + "]" }
+    }
+    return Logger{}
+}
+
+func (logger Logger) Log( level string, a ...interface{} ) {
+    if logger.prefix != "" {
+        a = append( []interface{}{ logger.prefix }, a... )
+    }
+    Log( level, a... )
+}
+
+func (logger Logger) Logf( level string, format string, a ...interface{} ) {
+    if logger.prefix != "" {
+        format = "%s " + format
+        a = append( []interface{}{ logger.prefix }, a... )
+    }
+    Logf( level, format, a... )
+}
+
+func (logger Logger) Error(     a ...interface{} ) { logger.Log( LevelError       , a... ) }
+func (logger Logger) Warning(   a ...interface{} ) { logger.Log( LevelWarning     , a... ) }
+func (logger Logger) Info(      a ...interface{} ) { logger.Log( LevelInfo        , a... ) }
+func (logger Logger) Success(   a ...interface{} ) { logger.Log( LevelSuccess     , a... ) }
+func (logger Logger) SubSection(a ...interface{} ) { logger.Log( LevelSubSection  , a... ) }
+func (logger Logger) Debug(     a ...interface{} ) { logger.Log( LevelDebug       , a... ) }
+
+func (logger Logger) Errorf(     format string, a ...interface{} ) { logger.Logf( LevelError      , format , a... ) }
+func (logger Logger) Warningf(   format string, a ...interface{} ) { logger.Logf( LevelWarning    , format , a... ) }
+func (logger Logger) Infof(      format string, a ...interface{} ) { logger.Logf( LevelInfo       , format , a... ) }
+func (logger Logger) Successf(   format string, a ...interface{} ) { logger.Logf( LevelSuccess    , format , a... ) }
+func (logger Logger) SubSectionf(format string, a ...interface{} ) { logger.Logf( LevelSubSection , format , a... ) }
+func (logger Logger) Debugf(     format string, a ...interface{} ) { logger.Logf( LevelDebug      , format , a... ) }
@@ -8,15 +8,18 @@ package login
 import (
     "fmt"
     "net/http"
+    "time"
 
     "github.com/GeraldWodni/kern.go/filter"
     "github.com/GeraldWodni/kern.go/log"
+    "github.com/GeraldWodni/kern.go/ratelimit"
     "github.com/GeraldWodni/kern.go/router"
     "github.com/GeraldWodni/kern.go/session"
     "github.com/GeraldWodni/kern.go/view"
 )
 
-var loginView *view.View
+// Limits login attempts per client IP, set to nil to disable
+var LoginLimiter = &ratelimit.Limiter{ Name: "login", Limit: 10, Window: time.Minute }
 // this field must be present for kern.go to recognize the request as a valid login request
 // TODO: replace this by a redis-based CSRF
 var loginField string
@@ -54,11 +57,6 @@ func checkCredentials( username string, password string ) (permissions string, o
 }
 
 func init() {
-    view, err := view.New( "login.gohtml" )
-    if err != nil {
-        log.Fatal( "login: cannot load view", err )
-    }
-    loginView = view
     loginField = session.NewSessionId()
     loginValue = session.NewSessionId()
 }
@@ -79,7 +77,7 @@ func loginOk( res http.ResponseWriter, req *http.Request, messages *[]view.Messa
     username := filter.Post( req, filter.Username )
     password := filter.Post( req, filter.Password )
     if permissions, ok := checkCredentials( username, password ); ok {
-        log.Successf( "login: '%s'", username )
+        log.Of( req ).Successf( "login: '%s'", username )
         s := session.New( res, req )
         s.Username = username
         s.Permissions = permissions
@@ -119,11 +117,11 @@ func renderForm( res http.ResponseWriter, req *http.Request, next router.RouteNe
         Username: filter.Post( req, filter.Username ),
         Messages: messages,
     }
-    loginView.Render( res, req, next, locals )
+    view.RenderNamed( res, req, http.StatusOK, "login", locals )
 }
 
 // Stops all further routing when `permission` is not held by current session.
-// Displays `loginView` (`login.gohtml`) when no session is found
+// Displays `login.gohtml` of the website's hierarchy when no session is found
 func PermissionReqired( path string, permission string ) (loginRouter *router.Router) {
     loginRouter = router.New( path )
     loginRouter.Name = "Login"
@@ -134,8 +132,11 @@ func PermissionReqired( path string, permission string ) (loginRouter *router.Ro
             next() // keep on routing
             return
         }
+        if LoginLimiter != nil && !LoginLimiter.Allow( res, req ) {
+            return
+        }
         if loginOk( res, req, &messages ) {
-            req.Method = "GET" // re-write method (login successfull)
+            router.OverrideMethod( req, http.MethodGet ) // continue as GET (login successfull)
             next() // keep on routing
             return
         }
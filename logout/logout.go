@@ -14,34 +14,24 @@ import (
     "github.com/GeraldWodni/kern.go/view"
 )
 
-var logoutView *view.View
-
-func init() {
-    view, err := view.New( "logout.gohtml" )
-    if err != nil {
-        log.Fatal( "logout: cannot load view", err )
-    }
-    logoutView = view
-}
-
 func renderView( res http.ResponseWriter, req *http.Request, next router.RouteNext, messages []view.Message ) {
     locals := struct{
         Messages []view.Message
     }{
         Messages: messages,
     }
-    logoutView.Render( res, req, next, locals )
+    view.RenderNamed( res, req, http.StatusOK, "logout", locals )
 }
 
 // Stops all further routing when `permission` is not held by current session.
-// Displays `logoutView` (`logout.gohtml`) when no session is found
+// Displays `logout.gohtml` of the website's hierarchy when no session is found, the route is named `logout` for `router.URLFor`
 func Logout( path string ) (logoutRouter *router.Router) {
     logoutRouter = router.New( path )
     logoutRouter.Name = "Logout"
     logoutRouter.All("/", func (res http.ResponseWriter, req *http.Request, next router.RouteNext ) {
         messages := []view.Message{};
         if s, ok := session.Of( req ); ok {
-            log.Infof( "Logout: %s", s.Username )
+            log.Of( req ).Infof( "Logout: %s", s.Username )
             session.Destroy( res, req )
             messages = append( messages, view.Message{
                 Type:  "success",
@@ -56,6 +46,6 @@ func Logout( path string ) (logoutRouter *router.Router) {
             })
         }
         renderView( res, req, next, messages )
-    })
+    }).Name( "logout" )
     return
 }
@@ -31,11 +31,17 @@ MODULES="
     view
     hierarchy
     redis
+    requestid
+    ratelimit
+    cors
+    security
+    accesslog
     filter
     session
     module
     login
     logout
+    debug
     log
     "
 
@@ -14,9 +14,11 @@ import (
 // Request-modules are invoked upon every request
 type Request interface {
     // Executed upon request start. Returns a new `http.request` - usually `reqIn` wrapped in a new `Context`.
-    // if `ok` is false, all further request handling will be stopped, handler needs to write `res` himself
+    // if `ok` is false, all further request handling will be stopped, handler needs to write `res` himself.
+    // Modules started before are ended, the stopping module's `EndRequest` is not called
     StartRequest(res http.ResponseWriter, reqIn *http.Request) (reqOut *http.Request, ok bool)
     // Executed upon exit of request
+    // Hint: delayed until handlers which overran their `Route.Timeout` return, the response is already sent then
     EndRequest(res http.ResponseWriter, req *http.Request)
 }
 
@@ -29,9 +31,14 @@ func RegisterRequest( requestModule Request ) {
 func ExecuteStartRequest( res http.ResponseWriter, reqIn *http.Request) (reqOut *http.Request, ok bool) {
     reqOut = reqIn
     ok = true
-    for _, requestModule := range( requestModules ) {
-        reqOut, ok = requestModule.StartRequest( res, reqOut )
+    for index, requestModule := range( requestModules ) {
+        started := reqOut
+        reqOut, ok = requestModule.StartRequest( res, started )
         if !ok {
+            // release resources of modules already started, i.e. redis connections
+            for i := index-1; i >= 0; i-- {
+                requestModules[i].EndRequest( res, started )
+            }
             return
         }
     }
@@ -0,0 +1,209 @@
+/*
+    rate limiting - sliding window counters stored in redis, answered with `429 Too Many Requests`
+
+    Use per router via `Limiter.Middleware` or globally via `module.RegisterRequest( limiter )`
+
+    (c)copyright 2021 by Gerald Wodni <gerald.wodni@gmail.com>
+*/
+package ratelimit
+
+import (
+    "errors"
+    "fmt"
+    "math"
+    "net"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+
+    redigo "github.com/gomodule/redigo/redis"
+
+    "github.com/GeraldWodni/kern.go/log"
+    "github.com/GeraldWodni/kern.go/redis"
+    "github.com/GeraldWodni/kern.go/router"
+    "github.com/GeraldWodni/kern.go/session"
+)
+
+const keyPrefix = "kern.go:ratelimit:"
+
+// Use first `X-Forwarded-For` address as client IP, only enable behind a trusted proxy
+var TrustForwardedFor = false
+
+// Key requests are counted by, empty keys are not limited
+type KeyFunc func( req *http.Request ) string
+
+// Count requests per client IP
+func ByIP( req *http.Request ) string {
+    return ClientIP( req )
+}
+
+// Count requests per logged in user, anonymous requests per client IP
+func ByUsername( req *http.Request ) string {
+    if s, ok := session.Of( req ); ok && s.LoggedIn {
+        return "user:" + s.Username
+    }
+    return ClientIP( req )
+}
+
+// get IP of client, see `TrustForwardedFor`
+func ClientIP( req *http.Request ) string {
+    if TrustForwardedFor {
+        if forwarded := req.Header.Get( "X-Forwarded-For" ); forwarded != "" {
+            first, _, _ := strings.Cut( forwarded, "," )
+            return strings.TrimSpace( first )
+        }
+    }
+    host, _, err := net.SplitHostPort( req.RemoteAddr )
+    if err != nil {
+        return req.RemoteAddr
+    }
+    return host
+}
+
+// Allows `Limit` requests per `Window`, i.e. `&ratelimit.Limiter{ Name: "api", Limit: 100, Window: time.Minute }`
+type Limiter struct {
+    // separates counters of limiters sharing keys
+    Name string
+    Limit int
+    Window time.Duration
+    // defaults to `ByIP`
+    Key KeyFunc
+    // only count these methods, i.e. `[]string{ http.MethodPost }`; all if empty
+    Methods []string
+}
+
+// Result of counting a request
+type Status struct {
+    Limit int
+    Remaining int
+    // until the current window ends
+    Reset time.Duration
+    // until a retried request is allowed, zero unless limited; rejected requests count as well
+    RetryAfter time.Duration
+}
+
+func (limiter *Limiter) counts( req *http.Request ) bool {
+    if len( limiter.Methods ) == 0 {
+        return true
+    }
+    for _, method := range limiter.Methods {
+        if req.Method == method {
+            return true
+        }
+    }
+    return false
+}
+
+// Count request identified by `key`.
+// The estimate weights the previous window by its overlap with the sliding window, i.e. 25% into the current window 75% of the previous count apply
+func (limiter *Limiter) Count( rdb redigo.Conn, key string, now time.Time ) (status Status, err error) {
+    window := limiter.Window.Milliseconds()
+    if window <= 0 {
+        err = errors.New( "ratelimit: Window must be at least 1ms" )
+        return
+    }
+    index := now.UnixMilli() / window
+    elapsed := float64( now.UnixMilli() % window ) / float64( window )
+    prefix := keyPrefix + limiter.Name + ":" + key + ":"
+
+    rdb.Send( "MULTI" )
+    rdb.Send( "GET", prefix + strconv.FormatInt( index - 1, 10 ) )
+    rdb.Send( "INCR", prefix + strconv.FormatInt( index, 10 ) )
+    rdb.Send( "PEXPIRE", prefix + strconv.FormatInt( index, 10 ), 2 * window )
+    values, err := redigo.Values( rdb.Do( "EXEC" ) )
+    if err != nil {
+        return
+    }
+    previous, err := redigo.Int( values[0], nil )
+    if err == redigo.ErrNil {
+        previous, err = 0, nil
+    }
+    if err != nil {
+        return
+    }
+    current, err := redigo.Int( values[1], nil )
+    if err != nil {
+        return
+    }
+
+    estimate := float64( previous ) * ( 1 - elapsed ) + float64( current )
+    status.Limit = limiter.Limit
+    status.Remaining = max( 0, limiter.Limit - int( math.Ceil( estimate ) ) )
+    status.Reset = time.Duration( ( 1 - elapsed ) * float64( window ) ) * time.Millisecond
+    if estimate > float64( limiter.Limit ) {
+        // rounded up to whole ms so retrying after `RetryAfter` is never early, ignoring float noise
+        wait := math.Ceil( limiter.retryAfter( previous, current, elapsed ) * float64( window ) - 1e-6 )
+        status.RetryAfter = max( time.Second, time.Duration( wait ) * time.Millisecond )
+    }
+    return
+}
+
+// windows until a retry is allowed, the retry itself is counted as well:
+// first `t` in this window with `previous * (1-t) + current + 1 <= Limit`,
+// otherwise `s` in the next window with `current * (1-s) + 1 <= Limit`, as this window becomes the previous one
+func (limiter *Limiter) retryAfter( previous int, current int, elapsed float64 ) float64 {
+    limit := float64( limiter.Limit )
+    if previous > 0 && float64( current + 1 ) <= limit {
+        return 1 - ( limit - float64( current + 1 ) ) / float64( previous ) - elapsed
+    }
+    return 1 - elapsed + max( 0, 1 - ( limit - 1 ) / float64( current ) )
+}
+
+// Count `req` and set `RateLimit-*` headers, responds with `429 Too Many Requests` and returns false when exceeded.
+// Hint: fails open, requests are allowed when redis is unavailable
+func (limiter *Limiter) Allow( res http.ResponseWriter, req *http.Request ) bool {
+    if !limiter.counts( req ) {
+        return true
+    }
+    keyFunc := limiter.Key
+    if keyFunc == nil {
+        keyFunc = ByIP
+    }
+    key := keyFunc( req )
+    if key == "" {
+        return true
+    }
+    rdb, ok := redis.Of( req )
+    if !ok {
+        log.Of( req ).Error( "ratelimit: redis not in http.Request context, is the module loaded?" )
+        return true
+    }
+    status, err := limiter.Count( rdb, key, time.Now() )
+    if err != nil {
+        log.Of( req ).Error( "ratelimit:", err )
+        return true
+    }
+
+    header := res.Header()
+    header.Set( "RateLimit-Limit", strconv.Itoa( status.Limit ) )
+    header.Set( "RateLimit-Remaining", strconv.Itoa( status.Remaining ) )
+    header.Set( "RateLimit-Reset", strconv.Itoa( seconds( status.Reset ) ) )
+    header.Set( "RateLimit-Policy", fmt.Sprintf( "%d;w=%d", limiter.Limit, seconds( limiter.Window ) ) )
+    if status.RetryAfter == 0 {
+        return true
+    }
+    header.Set( "Retry-After", strconv.Itoa( seconds( status.RetryAfter ) ) )
+    log.Of( req ).Warningf( "ratelimit %s: %s exceeded %d requests per %s", limiter.Name, key, limiter.Limit, limiter.Window )
+    router.Error( res, req, http.StatusTooManyRequests, errors.New( "Too many requests, please retry later" ) )
+    return false
+}
+
+// whole seconds, rounded up
+func seconds( duration time.Duration ) int {
+    return int( math.Ceil( duration.Seconds() ) )
+}
+
+// Limit all routes of a router, i.e. `apiRouter.Use( limiter.Middleware )`
+func (limiter *Limiter) Middleware( res http.ResponseWriter, req *http.Request, next router.MiddlewareNext ) {
+    if limiter.Allow( res, req ) {
+        next( res, req )
+    }
+}
+
+// implement module.Request interface to limit all requests
+func (limiter *Limiter) StartRequest(res http.ResponseWriter, reqIn *http.Request) (reqOut *http.Request, ok bool) {
+    return reqIn, limiter.Allow( res, reqIn )
+}
+func (limiter *Limiter) EndRequest(res http.ResponseWriter, req *http.Request) {
+}
@@ -0,0 +1,168 @@
+package ratelimit
+
+import (
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "testing"
+    "time"
+
+    redigo "github.com/gomodule/redigo/redis"
+
+    "github.com/GeraldWodni/kern.go/internal/redistest"
+    "github.com/GeraldWodni/kern.go/redis"
+    "github.com/GeraldWodni/kern.go/router"
+)
+
+// run against the in-memory stand-in unless `KERN_REDIS_ADDRESS` points to a real server
+func TestMain( m *testing.M ) {
+    if os.Getenv( "KERN_REDIS_ADDRESS" ) == "" {
+        server, err := redistest.Start()
+        if err != nil {
+            fmt.Println( "redistest:", err )
+            os.Exit( 1 )
+        }
+        redis.Address = server.Addr()
+        defer server.Close()
+    }
+    code := m.Run()
+    os.Exit( code )
+}
+
+func dial( t *testing.T ) redigo.Conn {
+    rdb, err := redigo.Dial( "tcp", redis.Address, redigo.DialConnectTimeout( time.Second ) )
+    if err != nil {
+        t.Fatal( err )
+    }
+    t.Cleanup( func() { rdb.Close() } )
+    return rdb
+}
+
+// counters of earlier runs must not interfere
+func uniqueName( t *testing.T ) string {
+    return fmt.Sprintf( "test:%s:%d", t.Name(), time.Now().UnixNano() )
+}
+
+// start of the current window, keys expire relative to the real clock so stay close to it
+func windowStart( window time.Duration ) time.Time {
+    return time.UnixMilli( time.Now().UnixMilli() / window.Milliseconds() * window.Milliseconds() )
+}
+
+func TestCountSlidingWindow( t *testing.T ) {
+    rdb := dial( t )
+    window := 10 * time.Second
+    limiter := &Limiter{ Name: uniqueName( t ), Limit: 3, Window: window }
+    start := windowStart( window )
+
+    for i := 1; i <= 3; i++ {
+        status, err := limiter.Count( rdb, "client", start )
+        if err != nil {
+            t.Fatal( err )
+        }
+        if status.Remaining != 3 - i || status.RetryAfter != 0 || status.Reset != window {
+            t.Fatalf( "request %d: %+v", i, status )
+        }
+    }
+    // 4 requests count fully until the next window and decay during it: 4 * (1 - s) + 1 <= 3 at s = 0.5
+    status, _ := limiter.Count( rdb, "client", start )
+    if status.Remaining != 0 || status.RetryAfter != window * 3 / 2 {
+        t.Fatalf( "exceeded: %+v", status )
+    }
+
+    // halfway into the next window half of the previous 4 requests still count: 4 * 0.5 + 1 = 3
+    halfway := start.Add( window + window / 2 )
+    status, _ = limiter.Count( rdb, "client", halfway )
+    if status.Remaining != 0 || status.RetryAfter != 0 || status.Reset != window / 2 {
+        t.Fatalf( "halfway: %+v", status )
+    }
+    // 4 * 0.5 + 2 = 4 exceeds 3, a retry adds 1: 4 * (1 - t) + 3 <= 3 only once this window ends
+    status, _ = limiter.Count( rdb, "client", halfway )
+    if status.RetryAfter != window / 2 {
+        t.Fatalf( "halfway exceeded: %+v", status )
+    }
+
+    // other keys have their own counters
+    status, _ = limiter.Count( rdb, "other", halfway )
+    if status.Remaining != 2 {
+        t.Fatalf( "other key: %+v", status )
+    }
+}
+
+// a client retrying exactly after `Retry-After` is allowed, one second earlier it is not
+func TestRetryAfterIsAllowed( t *testing.T ) {
+    rdb := dial( t )
+    window := 100 * time.Second
+    start := windowStart( window )
+    at := func( offset float64 ) time.Time {
+        return start.Add( time.Duration( offset * float64( window ) ) )
+    }
+
+    for _, c := range []struct{ name string; requests []time.Time; retryAfter time.Duration }{
+        { "current window exhausted", []time.Time{ at( 0 ), at( 0 ), at( 0 ), at( 0 ) }, 150 * time.Second },
+        { "previous window weighs", []time.Time{ at( 0 ), at( 0 ), at( 0 ), at( 1.5 ), at( 1.5 ) }, 50 * time.Second },
+        { "previous window exceeded", []time.Time{ at( 0 ), at( 0 ), at( 0 ), at( 0 ), at( 1.2 ) }, 55 * time.Second },
+    } {
+        // replay `requests` on a fresh counter, then count one more at `retry`
+        replay := func( retry time.Time ) (last Status, retried Status) {
+            limiter := &Limiter{ Name: uniqueName( t ), Limit: 3, Window: window }
+            var err error
+            for _, request := range c.requests {
+                if last, err = limiter.Count( rdb, "client", request ); err != nil {
+                    t.Fatal( err )
+                }
+            }
+            retried, _ = limiter.Count( rdb, "client", retry )
+            return
+        }
+
+        rejected := c.requests[ len( c.requests ) - 1 ]
+        last, retried := replay( rejected.Add( c.retryAfter ) )
+        if last.RetryAfter != c.retryAfter {
+            t.Errorf( "%s: Retry-After %s, expected %s", c.name, last.RetryAfter, c.retryAfter )
+            continue
+        }
+        if retried.RetryAfter != 0 {
+            t.Errorf( "%s: retry after %s rejected: %+v", c.name, c.retryAfter, retried )
+        }
+        if _, early := replay( rejected.Add( c.retryAfter - time.Second ) ); early.RetryAfter == 0 {
+            t.Errorf( "%s: retry a second early allowed", c.name )
+        }
+    }
+}
+
+func TestAllowHeaders( t *testing.T ) {
+    limiter := &Limiter{ Name: uniqueName( t ), Limit: 2, Window: time.Minute }
+    r := router.New( "/" )
+    r.Use( limiter.Middleware )
+    r.Get( "/", func( res http.ResponseWriter, req *http.Request, next router.RouteNext ) {
+        res.Write( []byte( "ok" ) )
+    })
+
+    for i := 1; i <= 3; i++ {
+        res := httptest.NewRecorder()
+        r.ServeHTTP( res, httptest.NewRequest( http.MethodGet, "/", nil ) )
+        header := res.Header()
+        if header.Get( "RateLimit-Limit" ) != "2" || header.Get( "RateLimit-Policy" ) != "2;w=60" || header.Get( "RateLimit-Reset" ) == "" {
+            t.Fatalf( "request %d: headers %v", i, header )
+        }
+        if i <= 2 {
+            if res.Code != http.StatusOK || header.Get( "RateLimit-Remaining" ) != fmt.Sprint( 2 - i ) || header.Get( "Retry-After" ) != "" {
+                t.Fatalf( "request %d: status %d, headers %v", i, res.Code, header )
+            }
+            continue
+        }
+        if res.Code != http.StatusTooManyRequests || header.Get( "RateLimit-Remaining" ) != "0" || header.Get( "Retry-After" ) == "" {
+            t.Fatalf( "request %d: status %d, headers %v", i, res.Code, header )
+        }
+    }
+}
+
+func TestMethodsNotCounted( t *testing.T ) {
+    limiter := &Limiter{ Name: uniqueName( t ), Limit: 1, Window: time.Minute, Methods: []string{ http.MethodPost } }
+    res := httptest.NewRecorder()
+    // GET requests are not counted at all
+    if !limiter.Allow( res, httptest.NewRequest( http.MethodGet, "/", nil ) ) || res.Header().Get( "RateLimit-Limit" ) != "" {
+        t.Fatalf( "GET counted: %v", res.Header() )
+    }
+}
@@ -0,0 +1,333 @@
+/*
+    Broker - fans out events published to a redis channel to all server-sent event streams of all replicas
+
+    (c)copyright 2021 by Gerald Wodni <gerald.wodni@gmail.com>
+*/
+package redis
+
+import (
+    "encoding/json"
+    "net/http"
+    "strconv"
+    "sync"
+    "time"
+
+    "github.com/gomodule/redigo/redis"
+
+    "github.com/GeraldWodni/kern.go/log"
+    "github.com/GeraldWodni/kern.go/router"
+)
+
+const brokerKeyPrefix = "kern.go:broker:"
+
+// Number of events each client may lag behind before it misses events
+var BrokerBuffer = 64
+
+// Fan-out of a redis channel, i.e.
+//     live := redis.NewBroker( "live" )
+//     app.Router.SSE( "/live", live.Handler() )
+//     live.Publish( router.Event{ Data: "update" } )
+// Hint: the channel is subscribed while clients are connected, `Close` disconnects all of them
+type Broker struct {
+    Channel string
+    // events kept for clients resuming via `Last-Event-ID`
+    History int
+    clients map[*Subscription]bool
+    mutex sync.Mutex
+    // closed to stop the running listener, nil if none runs
+    stop chan struct{}
+    // set once redis confirmed the subscription
+    conn *redis.PubSubConn
+}
+
+// Events of a `Broker` for one client, see `Subscribe`
+type Subscription struct {
+    // live events, closed by `Broker.Close`; events are dropped when the client lags `BrokerBuffer` events behind
+    Events chan router.Event
+    // signalled whenever the subscription is confirmed by redis, events published before might be missing from `Events`
+    Resync chan struct{}
+    broker *Broker
+    // logs dropped events, carries the request id of the client's stream
+    logger log.Logger
+}
+
+// Broker for redis channel `channel`
+func NewBroker( channel string ) *Broker {
+    return &Broker{
+        Channel: channel,
+        History: 100,
+        clients: make(map[*Subscription]bool),
+    }
+}
+
+func (broker *Broker) keyName( suffix string ) string {
+    return brokerKeyPrefix + broker.Channel + ":" + suffix
+}
+
+// assigns the id, appends to the history and publishes at once, so events reach subscribers in id order
+// KEYS: id counter, history; ARGV: event json without id, history length, channel
+const publishSource = `
+local id = string.format( "%d", redis.call( "INCR", KEYS[1] ) )
+local payload = '{"id":"' .. id .. '",' .. string.sub( ARGV[1], 2 )
+redis.call( "RPUSH", KEYS[2], payload )
+redis.call( "LTRIM", KEYS[2], -tonumber( ARGV[2] ), -1 )
+redis.call( "PUBLISH", ARGV[3], payload )
+return id
+`
+var publishScript = redis.NewScript( 2, publishSource )
+
+// Publish `event` to all subscribers of all replicas, its `Id` is assigned from a counter shared via redis
+func (broker *Broker) Publish( event router.Event ) (id string, err error) {
+    rdb := pool.Get()
+    defer rdb.Close()
+
+    // `Data` is never omitted, so the payload is a non-empty object the script can prepend the id to
+    event.Id = ""
+    payload, err := json.Marshal( event )
+    if err != nil {
+        return
+    }
+    return redis.String( publishScript.Do( rdb, broker.keyName( "id" ), broker.keyName( "history" ), payload, broker.History, broker.Channel ) )
+}
+
+// Receive events published from now on, wait for `Resync` to be sure the subscription is active; `Cancel` once done
+func (broker *Broker) Subscribe() *Subscription {
+    return broker.subscribe( log.Logger{} )
+}
+func (broker *Broker) subscribe( logger log.Logger ) (subscription *Subscription) {
+    subscription = &Subscription{
+        Events: make(chan router.Event, BrokerBuffer),
+        Resync: make(chan struct{}, 1),
+        broker: broker,
+        logger: logger,
+    }
+    broker.mutex.Lock()
+    defer broker.mutex.Unlock()
+    broker.clients[ subscription ] = true
+    if broker.stop == nil {
+        broker.stop = make(chan struct{})
+        go broker.listen( broker.stop )
+    } else if broker.conn != nil {
+        subscription.resync()
+    }
+    return
+}
+
+// Stop receiving events, the channel is unsubscribed when the last client leaves
+func (subscription *Subscription) Cancel() {
+    broker := subscription.broker
+    broker.mutex.Lock()
+    defer broker.mutex.Unlock()
+    delete( broker.clients, subscription )
+    if len( broker.clients ) == 0 {
+        broker.stopListening()
+    }
+}
+
+func (subscription *Subscription) resync() {
+    select {
+        case subscription.Resync <- struct{}{}:
+        default:
+    }
+}
+
+// Disconnect all clients and unsubscribe the channel, the broker can be used again afterwards
+func (broker *Broker) Close() {
+    broker.mutex.Lock()
+    defer broker.mutex.Unlock()
+    for subscription := range broker.clients {
+        close( subscription.Events )
+        delete( broker.clients, subscription )
+    }
+    broker.stopListening()
+}
+
+// `broker.mutex` must be held
+func (broker *Broker) stopListening() {
+    if broker.stop == nil {
+        return
+    }
+    close( broker.stop )
+    broker.stop = nil
+    // only sent once confirmed, the listener does not send on `conn` anymore then
+    if broker.conn != nil {
+        broker.conn.Unsubscribe()
+        broker.conn = nil
+    }
+}
+
+// id of the latest event, 0 if none was published yet
+func (broker *Broker) LastId() (id int64, err error) {
+    rdb := pool.Get()
+    defer rdb.Close()
+    id, err = redis.Int64( rdb.Do( "GET", broker.keyName( "id" ) ) )
+    if err == redis.ErrNil {
+        id, err = 0, nil
+    }
+    return
+}
+
+// get events with an id above `lastEventId` from the history
+func (broker *Broker) Since( lastEventId string ) (events []router.Event, err error) {
+    last, err := strconv.ParseInt( lastEventId, 10, 64 )
+    if err != nil {
+        return nil, nil
+    }
+    rdb := pool.Get()
+    defer rdb.Close()
+    payloads, err := redis.ByteSlices( rdb.Do( "LRANGE", broker.keyName( "history" ), 0, -1 ) )
+    if err != nil {
+        return
+    }
+    for _, payload := range payloads {
+        var event router.Event
+        if json.Unmarshal( payload, &event ) != nil {
+            continue
+        }
+        if id, _ := strconv.ParseInt( event.Id, 10, 64 ); id > last {
+            events = append( events, event )
+        }
+    }
+    return
+}
+
+// SSE handler streaming all events, resumed clients first receive the ones they missed
+// Hint: the history is replayed whenever redis confirms the subscription and when ids skip, so reconnects lose no events
+func (broker *Broker) Handler() router.SSEHandler {
+    return func( stream *router.EventStream, req *http.Request ) {
+        subscription := broker.subscribe( log.Of( req ) )
+        defer subscription.Cancel()
+
+        // resume after `Last-Event-ID`, new clients start with the events published from now on
+        last, err := strconv.ParseInt( stream.LastEventId, 10, 64 )
+        if err != nil {
+            if last, err = broker.LastId(); err != nil {
+                log.Of( req ).Error( "Broker:", err )
+                last = -1
+            }
+        }
+        send := func( event router.Event ) bool {
+            id, _ := strconv.ParseInt( event.Id, 10, 64 )
+            if id <= last {
+                return true
+            }
+            last = id
+            return stream.Send( event ) == nil
+        }
+        replay := func() bool {
+            if last < 0 {
+                return true
+            }
+            missed, err := broker.Since( strconv.FormatInt( last, 10 ) )
+            if err != nil {
+                log.Of( req ).Error( "Broker history:", err )
+            }
+            for _, event := range missed {
+                if !send( event ) {
+                    return false
+                }
+            }
+            return true
+        }
+
+        for {
+            select {
+                case <-req.Context().Done():
+                    return
+                case <-subscription.Resync:
+                    if !replay() {
+                        return
+                    }
+                case event, ok := <-subscription.Events:
+                    if !ok {
+                        return
+                    }
+                    // ids are consecutive, a gap means events were dropped or published before the subscription was confirmed
+                    if id, _ := strconv.ParseInt( event.Id, 10, 64 ); last >= 0 && id > last + 1 && !replay() {
+                        return
+                    }
+                    if !send( event ) {
+                        return
+                    }
+            }
+        }
+    }
+}
+
+// forward channel messages to subscribers until `stop` is closed, reconnects after redis errors
+// Hint: the listener is shared by all clients, so its errors are logged without request id
+func (broker *Broker) listen( stop chan struct{} ) {
+    for {
+        conn := &redis.PubSubConn{ Conn: pool.Get() }
+        if err := conn.Subscribe( broker.Channel ); err != nil {
+            log.Error( "Broker subscribe:", err )
+        } else {
+            broker.receive( conn, stop )
+        }
+        broker.mutex.Lock()
+        if broker.conn == conn {
+            broker.conn = nil
+        }
+        broker.mutex.Unlock()
+        conn.Close()
+        select {
+            case <-stop:
+                return
+            case <-time.After( time.Second ):
+        }
+    }
+}
+
+func (broker *Broker) receive( conn *redis.PubSubConn, stop chan struct{} ) {
+    for {
+        switch message := conn.Receive().(type) {
+            case redis.Subscription:
+                if message.Kind == "subscribe" && !broker.confirm( conn, stop ) {
+                    conn.Unsubscribe()
+                }
+                if message.Kind == "unsubscribe" && message.Count == 0 {
+                    return
+                }
+            case redis.Message:
+                var event router.Event
+                if err := json.Unmarshal( message.Data, &event ); err != nil {
+                    log.Error( "Broker message:", err )
+                    continue
+                }
+                broker.fanOut( event, stop )
+            case error:
+                log.Error( "Broker receive:", message )
+                return
+        }
+    }
+}
+
+// subscription is active: events are received from now on, clients replay what they missed meanwhile
+func (broker *Broker) confirm( conn *redis.PubSubConn, stop chan struct{} ) bool {
+    broker.mutex.Lock()
+    defer broker.mutex.Unlock()
+    if broker.stop != stop {
+        return false
+    }
+    broker.conn = conn
+    for subscription := range broker.clients {
+        subscription.resync()
+    }
+    return true
+}
+
+func (broker *Broker) fanOut( event router.Event, stop chan struct{} ) {
+    broker.mutex.Lock()
+    defer broker.mutex.Unlock()
+    // a stopped listener may still receive until redis confirms the unsubscribe
+    if broker.stop != stop {
+        return
+    }
+    for subscription := range broker.clients {
+        select {
+            case subscription.Events <- event:
+            default:
+                subscription.logger.Warningf( "Broker %s: client too slow, dropping event %s", broker.Channel, event.Id )
+        }
+    }
+}
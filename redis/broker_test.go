@@ -0,0 +1,233 @@
+package redis
+
+import (
+    "bufio"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "strconv"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+
+    "github.com/GeraldWodni/kern.go/internal/redistest"
+    "github.com/GeraldWodni/kern.go/router"
+)
+
+// in-memory stand-in unless `KERN_REDIS_ADDRESS` points to a real server
+var standIn *redistest.Server
+
+func TestMain( m *testing.M ) {
+    if os.Getenv( "KERN_REDIS_ADDRESS" ) == "" {
+        var err error
+        if standIn, err = redistest.Start(); err != nil {
+            fmt.Println( "redistest:", err )
+            os.Exit( 1 )
+        }
+        Address = standIn.Addr()
+        // Go version of `publishSource`
+        standIn.Script( publishSource, func( call func( string, ...string ) (interface{}, error), keys []string, argv []string ) (interface{}, error) {
+            counter, err := call( "INCR", keys[0] )
+            if err != nil {
+                return nil, err
+            }
+            id := strconv.FormatInt( counter.(int64), 10 )
+            payload := `{"id":"` + id + `",` + argv[0][1:]
+            call( "RPUSH", keys[1], payload )
+            call( "LTRIM", keys[1], "-" + argv[1], "-1" )
+            call( "PUBLISH", argv[2], payload )
+            return id, nil
+        })
+    }
+    code := m.Run()
+    if standIn != nil {
+        standIn.Close()
+    }
+    os.Exit( code )
+}
+
+// fresh channel, so ids start at 1
+func testBroker( t *testing.T ) *Broker {
+    broker := NewBroker( fmt.Sprintf( "test:%s:%d", t.Name(), time.Now().UnixNano() ) )
+    t.Cleanup( broker.Close )
+    return broker
+}
+
+func publish( t *testing.T, broker *Broker, data string ) string {
+    id, err := broker.Publish( router.Event{ Data: data } )
+    if err != nil {
+        t.Fatal( err )
+    }
+    return id
+}
+
+// SSE client of `broker`, resuming after `lastEventId` unless empty
+func streamBroker( t *testing.T, broker *Broker, lastEventId string ) *bufio.Reader {
+    r := router.New( "/" )
+    r.SSE( "/live", broker.Handler() )
+    server := httptest.NewServer( r )
+    t.Cleanup( server.Close )
+    req, _ := http.NewRequest( http.MethodGet, server.URL + "/live", nil )
+    if lastEventId != "" {
+        req.Header.Set( "Last-Event-ID", lastEventId )
+    }
+    res, err := ( &http.Client{ Timeout: 10 * time.Second } ).Do( req )
+    if err != nil {
+        t.Fatal( err )
+    }
+    t.Cleanup( func() { res.Body.Close() } )
+    return bufio.NewReader( res.Body )
+}
+
+// read next event of a `text/event-stream`, comments are skipped
+func readEvent( t *testing.T, reader *bufio.Reader ) (id string, data string) {
+    for {
+        line, err := reader.ReadString( '\n' )
+        if err != nil {
+            t.Fatal( err )
+        }
+        line = strings.TrimSuffix( line, "\n" )
+        switch {
+            case line == "" && data != "":
+                return
+            case strings.HasPrefix( line, "id: " ):
+                id = line[4:]
+            case strings.HasPrefix( line, "data: " ):
+                data = line[6:]
+        }
+    }
+}
+
+func expectEvent( t *testing.T, reader *bufio.Reader, expectedId int, expectedData string ) {
+    t.Helper()
+    if id, data := readEvent( t, reader ); id != strconv.Itoa( expectedId ) || data != expectedData {
+        t.Fatalf( "id %q data %q, expected %d %q", id, data, expectedId, expectedData )
+    }
+}
+
+// wait until the broker listens on redis
+func waitSubscribed( t *testing.T, broker *Broker, subscribed bool ) {
+    t.Helper()
+    for deadline := time.Now().Add( 5 * time.Second ); time.Now().Before( deadline ); time.Sleep( 10 * time.Millisecond ) {
+        broker.mutex.Lock()
+        active := broker.conn != nil
+        broker.mutex.Unlock()
+        if active == subscribed && ( standIn == nil || ( standIn.Subscribers( broker.Channel ) > 0 ) == subscribed ) {
+            return
+        }
+    }
+    t.Fatalf( "broker subscribed should be %v", subscribed )
+}
+
+func TestBrokerResumeAndLive( t *testing.T ) {
+    broker := testBroker( t )
+    for i := 1; i <= 3; i++ {
+        if id := publish( t, broker, fmt.Sprintf( "event %d", i ) ); id != strconv.Itoa( i ) {
+            t.Fatalf( "id %q, expected %d", id, i )
+        }
+    }
+
+    reader := streamBroker( t, broker, "1" )
+    // missed events from the history
+    expectEvent( t, reader, 2, "event 2" )
+    expectEvent( t, reader, 3, "event 3" )
+    // history is replayed once subscribed, so this is either replayed or live
+    publish( t, broker, "event 4" )
+    expectEvent( t, reader, 4, "event 4" )
+}
+
+// new clients receive events published from now on only
+func TestBrokerNewClient( t *testing.T ) {
+    broker := testBroker( t )
+    publish( t, broker, "old" )
+    reader := streamBroker( t, broker, "" )
+    waitSubscribed( t, broker, true )
+    publish( t, broker, "new" )
+    expectEvent( t, reader, 2, "new" )
+}
+
+// events published while the listener reconnects are replayed from the history
+func TestBrokerReconnect( t *testing.T ) {
+    if standIn == nil {
+        t.Skip( "needs the stand-in to drop connections" )
+    }
+    broker := testBroker( t )
+    reader := streamBroker( t, broker, "" )
+    waitSubscribed( t, broker, true )
+    publish( t, broker, "before" )
+    expectEvent( t, reader, 1, "before" )
+
+    standIn.DropConnections()
+    // idle connections of the pool were dropped as well
+    for attempt := 0; ; attempt++ {
+        if _, err := broker.Publish( router.Event{ Data: "while down" } ); err == nil {
+            break
+        } else if attempt > 20 {
+            t.Fatal( err )
+        }
+    }
+    expectEvent( t, reader, 2, "while down" )
+    publish( t, broker, "after" )
+    expectEvent( t, reader, 3, "after" )
+}
+
+// concurrent publishers must deliver events in id order, otherwise `Handler` drops the late ones
+func TestBrokerOrder( t *testing.T ) {
+    broker := testBroker( t )
+    subscription := broker.Subscribe()
+    defer subscription.Cancel()
+    select {
+        case <-subscription.Resync:
+        case <-time.After( 5 * time.Second ):
+            t.Fatal( "subscription not confirmed" )
+    }
+
+    var wait sync.WaitGroup
+    for publisher := 0; publisher < 4; publisher++ {
+        wait.Add( 1 )
+        go func() {
+            defer wait.Done()
+            for i := 0; i < 10; i++ {
+                if _, err := broker.Publish( router.Event{ Data: "order" } ); err != nil {
+                    t.Error( err )
+                    return
+                }
+            }
+        }()
+    }
+    wait.Wait()
+
+    for expected := 1; expected <= 40; expected++ {
+        select {
+            case event := <-subscription.Events:
+                if event.Id != strconv.Itoa( expected ) {
+                    t.Fatalf( "id %s, expected %d", event.Id, expected )
+                }
+            case <-time.After( 5 * time.Second ):
+                t.Fatalf( "event %d not received", expected )
+        }
+    }
+}
+
+// the channel is unsubscribed when the last client leaves, `Close` ends all clients
+func TestBrokerStops( t *testing.T ) {
+    broker := testBroker( t )
+    first, second := broker.Subscribe(), broker.Subscribe()
+    waitSubscribed( t, broker, true )
+    first.Cancel()
+    waitSubscribed( t, broker, true )
+    second.Cancel()
+    waitSubscribed( t, broker, false )
+
+    // subscribed again on demand
+    third := broker.Subscribe()
+    waitSubscribed( t, broker, true )
+    broker.Close()
+    if _, ok := <-third.Events; ok {
+        t.Fatal( "events open after Close" )
+    }
+    waitSubscribed( t, broker, false )
+    third.Cancel()
+}
@@ -9,7 +9,9 @@ package redis
 
 import (
     "context"
+    "errors"
     "net/http"
+    "os"
     "time"
 
     "github.com/gomodule/redigo/redis"
@@ -18,18 +20,21 @@ import (
     "github.com/GeraldWodni/kern.go/module"
 )
 
-// TODO: make configureable
-const address = "localhost:6379"
+// Server used by the pool, i.e. a local redis-compatible stand-in for tests; set via `KERN_REDIS_ADDRESS`
+var Address = "localhost:6379"
 
 var pool *redis.Pool
 
 // statically initialize pool
 func init() {
+    if address := os.Getenv( "KERN_REDIS_ADDRESS" ); address != "" {
+        Address = address
+    }
     pool = &redis.Pool{
         MaxIdle: 10,
         IdleTimeout: 240 * time.Second,
         Dial: func() (redis.Conn, error) {
-            return redis.Dial("tcp", address)
+            return redis.Dial("tcp", Address)
         },
     }
 }
@@ -57,6 +62,15 @@ func init() {
     log.Info( "redis module registered" )
 }
 
+// Run command on the connection of `req`, aborted once `req.Context()` is done, i.e. by `router.Route.Timeout`
+func Do( req *http.Request, command string, args ...interface{} ) (reply interface{}, err error) {
+    rdb, ok := Of( req )
+    if !ok {
+        return nil, errors.New( "redis not in http.Request context, is the module loaded?" )
+    }
+    return redis.DoContext( rdb, req.Context(), command, args... )
+}
+
 // get redis connection from request-context
 // i.e. `redis.Of( req ).Do( "SET", "Lana", "aaaaaaaaa" )`
 func Of( req *http.Request ) (rdb redis.Conn, ok bool) {
@@ -0,0 +1,71 @@
+/*
+    request id module - assigns an id to every request or honours an incoming `X-Request-ID`,
+    echoed in the response header and prefixed to all lines logged via `log.Of( req )`
+
+    (c)copyright 2021 by Gerald Wodni <gerald.wodni@gmail.com>
+*/
+package requestid
+
+import (
+    "crypto/rand"
+    "fmt"
+    "net/http"
+
+    "github.com/GeraldWodni/kern.go/log"
+    "github.com/GeraldWodni/kern.go/module"
+)
+
+// Request and response header carrying the id
+const Header = log.RequestIdHeader
+
+// Honour ids sent by clients or proxies, disable when clients are not trusted
+var TrustIncoming = true
+
+// New random request id
+func New() string {
+    buffer := make([]byte, 16)
+    rand.Read( buffer )
+    return fmt.Sprintf( "%x", buffer )
+}
+
+// incoming ids end up in logs and headers, accept only short printable ones
+func valid( requestId string ) bool {
+    if requestId == "" || len( requestId ) > 128 {
+        return false
+    }
+    for _, c := range requestId {
+        switch {
+            case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+            case c == '-' || c == '_' || c == '.' || c == ':' || c == '/' || c == '+' || c == '=':
+            default:
+                return false
+        }
+    }
+    return true
+}
+
+// implement module.Request interface (privately)
+type requestIdModule struct {}
+func (m *requestIdModule) StartRequest(res http.ResponseWriter, reqIn *http.Request) (reqOut *http.Request, ok bool) {
+    ok=true
+    requestId := reqIn.Header.Get( Header )
+    if !TrustIncoming || !valid( requestId ) {
+        requestId = New()
+    }
+    res.Header().Set( Header, requestId )
+    reqOut = reqIn.WithContext( log.WithRequestId( reqIn.Context(), requestId ) )
+    return
+}
+func (m *requestIdModule) EndRequest(res http.ResponseWriter, req *http.Request) {
+}
+
+// privatly register this module upon import
+func init() {
+    module.RegisterRequest( module.Request(& requestIdModule{}) )
+    log.Info( "requestid module registered" )
+}
+
+// get request id from request-context, empty if the module is not loaded
+func Of( req *http.Request ) string {
+    return log.RequestIdOf( req.Context() )
+}
@@ -0,0 +1,217 @@
+/*
+    Compression - gzip or deflate for text responses as negotiated via `Accept-Encoding`,
+    precompressed `.gz` files next to the originals are served as is
+
+    (c)copyright 2021 by Gerald Wodni <gerald.wodni@gmail.com>
+*/
+package router
+
+import (
+    "compress/gzip"
+    "compress/zlib"
+    "io"
+    "io/fs"
+    "mime"
+    "net/http"
+    "strconv"
+    "strings"
+
+    "github.com/GeraldWodni/kern.go/log"
+)
+
+// Compress text responses, attach via `router.Use( router.Compress )`.
+// Already encoded responses, partial content and binary types like images are passed through unchanged.
+func Compress( res http.ResponseWriter, req *http.Request, next MiddlewareNext ) {
+    compressRes := &compressWriter{
+        ResponseWriter: res,
+        encoding: negotiateEncoding( req ),
+        logger: log.Of( req ),
+    }
+    defer compressRes.Close()
+    next( compressRes, req )
+}
+
+// Check if responses of `contentType` benefit from compression
+func Compressible( contentType string ) bool {
+    mediaType, _, err := mime.ParseMediaType( contentType )
+    if err != nil {
+        return false
+    }
+    switch {
+        // streams need to reach the client immediately
+        case mediaType == "text/event-stream":
+            return false
+        case strings.HasPrefix( mediaType, "text/" ):
+            return true
+        case strings.HasSuffix( mediaType, "+json" ) || strings.HasSuffix( mediaType, "+xml" ):
+            return true
+    }
+    switch mediaType {
+        case "application/json", "application/javascript", "application/xml", "image/svg+xml":
+            return true
+    }
+    return false
+}
+
+// quality of `encoding` in the `Accept-Encoding` header, 0 if not acceptable
+func acceptsEncoding( req *http.Request, encoding string ) (quality float64) {
+    for _, accept := range strings.Split( req.Header.Get( "Accept-Encoding" ), "," ) {
+        name, params, _ := strings.Cut( strings.TrimSpace( accept ), ";" )
+        if name != encoding && name != "*" {
+            continue
+        }
+        value := 1.0
+        if q, ok := strings.CutPrefix( strings.TrimSpace( params ), "q=" ); ok {
+            if parsed, err := strconv.ParseFloat( q, 64 ); err == nil {
+                value = parsed
+            }
+        }
+        // explicit encoding beats `*`
+        if name == encoding {
+            return value
+        }
+        quality = value
+    }
+    return
+}
+
+// pick best supported encoding, empty for identity
+func negotiateEncoding( req *http.Request ) string {
+    gzipQuality := acceptsEncoding( req, "gzip" )
+    deflateQuality := acceptsEncoding( req, "deflate" )
+    switch {
+        case gzipQuality > 0 && gzipQuality >= deflateQuality:
+            return "gzip"
+        case deflateQuality > 0:
+            return "deflate"
+    }
+    return ""
+}
+
+// compresses the body once the header reveals a compressible response
+type compressWriter struct {
+    http.ResponseWriter
+    encoding string
+    compressor io.WriteCloser
+    headerWritten bool
+    logger log.Logger
+}
+
+func (res *compressWriter) WriteHeader( status int ) {
+    if res.headerWritten {
+        return
+    }
+    res.headerWritten = true
+
+    header := res.Header()
+    contentType := header.Get( "Content-Type" )
+    if Compressible( contentType ) {
+        AddVary( header, "Accept-Encoding" )
+    }
+    if compressibleStatus( status ) && res.compresses( header, contentType ) {
+        header.Set( "Content-Encoding", res.encoding )
+        header.Del( "Content-Length" )
+        // compressed body differs byte-wise from the identity one
+        if etag := header.Get( "ETag" ); etag != "" && !strings.HasPrefix( etag, "W/" ) {
+            header.Set( "ETag", "W/" + etag )
+        }
+        if res.encoding == "gzip" {
+            res.compressor = gzip.NewWriter( res.ResponseWriter )
+        } else {
+            // `deflate` content coding is the zlib format (RFC 9110), not raw deflate
+            res.compressor, _ = zlib.NewWriterLevel( res.ResponseWriter, zlib.DefaultCompression )
+        }
+    }
+    res.ResponseWriter.WriteHeader( status )
+}
+
+// check if a response with `header` and `contentType` gets compressed
+func (res *compressWriter) compresses( header http.Header, contentType string ) bool {
+    return res.encoding != "" && header.Get( "Content-Encoding" ) == "" && Compressible( contentType )
+}
+
+// get `compressWriter` wrapped by `res`, i.e. to know the `ETag` of a compressed file before `WriteHeader`
+func compressorOf( res http.ResponseWriter ) (compressor *compressWriter, ok bool) {
+    for res != nil {
+        if compressor, ok = res.(*compressWriter); ok {
+            return
+        }
+        unwrapper, canUnwrap := res.(interface{ Unwrap() http.ResponseWriter })
+        if !canUnwrap {
+            break
+        }
+        res = unwrapper.Unwrap()
+    }
+    return nil, false
+}
+
+func compressibleStatus( status int ) bool {
+    return status >= 200 && status != http.StatusNoContent && status != http.StatusPartialContent && status != http.StatusNotModified
+}
+
+func (res *compressWriter) Write( b []byte ) (int, error) {
+    if !res.headerWritten {
+        if res.Header().Get( "Content-Type" ) == "" {
+            res.Header().Set( "Content-Type", http.DetectContentType( b ) )
+        }
+        res.WriteHeader( http.StatusOK )
+    }
+    if res.compressor != nil {
+        return res.compressor.Write( b )
+    }
+    return res.ResponseWriter.Write( b )
+}
+
+func (res *compressWriter) Flush() {
+    res.FlushError()
+}
+
+// flush compressor and wrapped writers, used by `http.ResponseController`
+func (res *compressWriter) FlushError() error {
+    if flusher, ok := res.compressor.(interface{ Flush() error }); ok {
+        if err := flusher.Flush(); err != nil {
+            return err
+        }
+    }
+    return http.NewResponseController( res.ResponseWriter ).Flush()
+}
+
+// expose wrapped writer to `http.ResponseController`, i.e. to hijack WebSocket connections
+func (res *compressWriter) Unwrap() http.ResponseWriter {
+    return res.ResponseWriter
+}
+
+func (res *compressWriter) Close() {
+    if res.compressor == nil {
+        return
+    }
+    if err := res.compressor.Close(); err != nil {
+        res.logger.Error( "Router compress:", err )
+    }
+}
+
+// get precompressed `name.gz` of `fsys` if the client accepts gzip, `Vary` is set whenever one exists
+func precompressed( res http.ResponseWriter, req *http.Request, fsys fs.FS, name string ) (gzipName string, ok bool) {
+    gzipName = name + ".gz"
+    if info, err := fs.Stat( fsys, gzipName ); err != nil || info.IsDir() {
+        return "", false
+    }
+    AddVary( res.Header(), "Accept-Encoding" )
+    if acceptsEncoding( req, "gzip" ) <= 0 {
+        return "", false
+    }
+    res.Header().Set( "Content-Encoding", "gzip" )
+    return gzipName, true
+}
+
+// Add `name` to the `Vary` header unless already present, i.e. `router.AddVary( res.Header(), "Origin" )`
+func AddVary( header http.Header, name string ) {
+    for _, vary := range header.Values( "Vary" ) {
+        for _, field := range strings.Split( vary, "," ) {
+            if strings.EqualFold( strings.TrimSpace( field ), name ) {
+                return
+            }
+        }
+    }
+    header.Add( "Vary", name )
+}
@@ -0,0 +1,47 @@
+package router
+
+import (
+    "compress/gzip"
+    "compress/zlib"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+)
+
+func TestCompressEncodings( t *testing.T ) {
+    text := strings.Repeat( "kern.go compresses text responses\n", 100 )
+    r := New( "/" )
+    r.Use( Compress )
+    r.Get( "/text", func( res http.ResponseWriter, req *http.Request, next RouteNext ) {
+        res.Header().Set( "Content-Type", "text/plain; charset=utf-8" )
+        io.WriteString( res, text )
+    })
+
+    decoders := map[string]func( io.Reader ) (io.Reader, error){
+        "gzip": func( reader io.Reader ) (io.Reader, error) { return gzip.NewReader( reader ) },
+        "deflate": func( reader io.Reader ) (io.Reader, error) { return zlib.NewReader( reader ) },
+    }
+    for encoding, decoder := range decoders {
+        req := httptest.NewRequest( http.MethodGet, "/text", nil )
+        req.Header.Set( "Accept-Encoding", encoding )
+        res := httptest.NewRecorder()
+        r.ServeHTTP( res, req )
+
+        if got := res.Header().Get( "Content-Encoding" ); got != encoding {
+            t.Fatalf( "Content-Encoding %q, expected %q", got, encoding )
+        }
+        reader, err := decoder( res.Body )
+        if err != nil {
+            t.Fatalf( "%s: %s", encoding, err )
+        }
+        body, err := io.ReadAll( reader )
+        if err != nil {
+            t.Fatalf( "%s: %s", encoding, err )
+        }
+        if string( body ) != text {
+            t.Fatalf( "%s: body differs", encoding )
+        }
+    }
+}
@@ -0,0 +1,144 @@
+/*
+    Error responses - status code specific error pages and `application/problem+json` (RFC 7807)
+
+    (c)copyright 2021 by Gerald Wodni <gerald.wodni@gmail.com>
+*/
+package router
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "html"
+    "mime"
+    "net/http"
+    "strconv"
+    "strings"
+
+    "github.com/GeraldWodni/kern.go/log"
+)
+
+// Problem details as defined by RFC 7807
+type Problem struct {
+    Type string         `json:"type"`
+    Title string        `json:"title"`
+    Status int          `json:"status"`
+    Detail string       `json:"detail,omitempty"`
+    Instance string     `json:"instance,omitempty"`
+    RequestId string    `json:"requestId,omitempty"`
+}
+
+// Error carrying its response status, i.e. `&router.StatusError{ http.StatusNotFound, err }`
+type StatusError struct {
+    Status int
+    Err error
+}
+
+func (err *StatusError) Error() string {
+    if err.Err == nil {
+        return http.StatusText( err.Status )
+    }
+    return err.Err.Error()
+}
+
+func (err *StatusError) Unwrap() error {
+    return err.Err
+}
+
+func (err *StatusError) StatusCode() int {
+    return err.Status
+}
+
+// Returned by controllers for unknown ids
+var ErrNotFound = &StatusError{ http.StatusNotFound, errors.New( "not found" ) }
+
+// Respond with an error page for `status`, `err` is optional.
+// Clients preferring JSON receive `application/problem+json`, all others are passed to the `ErrorHandler` of the serving router.
+// Hint: details of errors with status >= 500 are only exposed in `Development` mode
+func Error( res http.ResponseWriter, req *http.Request, status int, err error ) {
+    if err != nil && status >= 500 {
+        if _, ok := err.(*PanicError); !ok {
+            log.Of( req ).Error( err )
+        }
+    }
+
+    if PrefersJSON( req ) {
+        problemJSON( res, req, status, err )
+        return
+    }
+
+    if state, ok := stateOf( req ); ok && state.router != nil && state.router.ErrorHandler != nil {
+        state.router.ErrorHandler( res, req, status, err )
+        return
+    }
+    errorHtml( res, req, status, err )
+}
+
+// Human readable message for `err`, hides details of server errors unless in `Development` mode
+func ErrorMessage( status int, err error ) string {
+    if err == nil || ( status >= 500 && !Development ) {
+        return http.StatusText( status )
+    }
+    return err.Error()
+}
+
+// Request id for error pages and logs as assigned by the `requestid` module, falls back to the `X-Request-ID` header
+func RequestId( req *http.Request ) string {
+    if requestId := log.RequestIdOf( req.Context() ); requestId != "" {
+        return requestId
+    }
+    return req.Header.Get( "X-Request-ID" )
+}
+
+func problemJSON( res http.ResponseWriter, req *http.Request, status int, err error ) {
+    problem := Problem{
+        Type: "about:blank",
+        Title: http.StatusText( status ),
+        Status: status,
+        Detail: ErrorMessage( status, err ),
+        Instance: OriginalPath( req ),
+        RequestId: RequestId( req ),
+    }
+    res.Header().Set( "Content-Type", "application/problem+json" )
+    res.WriteHeader( status )
+    if err := json.NewEncoder( res ).Encode( problem ); err != nil {
+        log.Of( req ).Error( "Router problem+json:", err )
+    }
+}
+
+// fallback when no `ErrorHandler` is set
+func errorHtml( res http.ResponseWriter, req *http.Request, status int, err error ) {
+    title := fmt.Sprintf( "%d %s", status, http.StatusText( status ) )
+    res.Header().Set( "Content-Type", "text/html; charset=utf-8" )
+    res.WriteHeader( status )
+    fmt.Fprintf( res, `<html lang="en"><head><title>%s</title></head><body><h1>%s</h1><p>%s</p>`,
+        html.EscapeString( title ), html.EscapeString( title ), html.EscapeString( ErrorMessage( status, err ) ) )
+    if panicErr, ok := err.(*PanicError); ok && Development {
+        fmt.Fprintf( res, "<pre>%s</pre>", html.EscapeString( string( panicErr.Stack ) ) )
+    }
+    fmt.Fprint( res, "</body></html>" )
+}
+
+// Check if the `Accept` header ranks JSON higher than HTML
+func PrefersJSON( req *http.Request ) bool {
+    jsonQuality, htmlQuality := 0.0, 0.0
+    for _, accept := range strings.Split( req.Header.Get( "Accept" ), "," ) {
+        mediaType, params, err := mime.ParseMediaType( strings.TrimSpace( accept ) )
+        if err != nil {
+            continue
+        }
+        quality := 1.0
+        if q, ok := params[ "q" ]; ok {
+            if quality, err = strconv.ParseFloat( q, 64 ); err != nil {
+                continue
+            }
+        }
+        switch {
+            case mediaType == "application/json" || strings.HasSuffix( mediaType, "+json" ):
+                jsonQuality = max( jsonQuality, quality )
+            case mediaType == "text/html" || mediaType == "application/xhtml+xml":
+                htmlQuality = max( htmlQuality, quality )
+        }
+    }
+    return jsonQuality > htmlQuality
+}
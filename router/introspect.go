@@ -0,0 +1,110 @@
+/*
+    Introspection - walk the tree of mounted routers and trace which routes handled a request
+
+    (c)copyright 2021 by Gerald Wodni <gerald.wodni@gmail.com>
+*/
+package router
+
+import (
+    "net/http"
+    "reflect"
+    "runtime"
+
+    "github.com/GeraldWodni/kern.go/log"
+)
+
+// Description of a `Router` and all routers mounted on it
+type RouterInfo struct {
+    Name string
+    MountPoint string
+    StripPrefix bool
+    Middlewares []string
+    Routes []RouteInfo
+}
+
+// Description of a single `Route`, `Mounted` is set for routes added by `Mount`
+type RouteInfo struct {
+    Method string
+    Path string
+    // absolute path including mount points of enclosing routers
+    FullPath string
+    Name string
+    Handler string
+    Mounted *RouterInfo `json:",omitempty"`
+}
+
+// Route tried while serving a request, `Resumed` is set if the handler called `next()`
+type TraceEntry struct {
+    Router string
+    Method string
+    Path string
+    Handler string
+    Resumed bool
+}
+
+// Describe router and its mounted routers recursively
+func (router *Router) Describe() (info RouterInfo) {
+    info = RouterInfo{
+        Name: router.Name,
+        MountPoint: router.MountPoint,
+        StripPrefix: router.StripPrefix,
+        Middlewares: []string{},
+        Routes: []RouteInfo{},
+    }
+    for _, middleware := range router.Middlewares {
+        info.Middlewares = append( info.Middlewares, funcName( middleware ) )
+    }
+    _, routes := router.compile()
+    for _, route := range routes {
+        routeInfo := RouteInfo{
+            Method: route.Method,
+            Path: route.Path,
+            FullPath: route.FullPath(),
+            Name: route.name,
+            Handler: funcName( route.Handler ),
+        }
+        if route.mounted != nil {
+            mounted := route.mounted.Describe()
+            routeInfo.Mounted = &mounted
+        }
+        info.Routes = append( info.Routes, routeInfo )
+    }
+    return
+}
+
+// get routes tried so far while serving `req`, only recorded when the serving router has `Trace` set
+func TraceOf( req *http.Request ) []TraceEntry {
+    if state, ok := stateOf( req ); ok {
+        return state.trace
+    }
+    return nil
+}
+
+// remember `route` as tried, returns index to record resumption
+func (state *requestState) traceRoute( router *Router, route *Route ) int {
+    state.trace = append( state.trace, TraceEntry{
+        Router: router.Name,
+        Method: route.Method,
+        Path: route.Path,
+        Handler: funcName( route.Handler ),
+    })
+    return len( state.trace ) - 1
+}
+
+func logTrace( req *http.Request ) {
+    for _, entry := range TraceOf( req ) {
+        log.Of( req ).Debugf( "Trace %s %s: router '%s' %s %s -> %s (next: %t)", req.Method, req.URL.Path, entry.Router, entry.Method, entry.Path, entry.Handler, entry.Resumed )
+    }
+}
+
+// reflection based function name, i.e. `github.com/GeraldWodni/kern.go/router.(*Router).HierarchyDir.func1`
+func funcName( function interface{} ) string {
+    value := reflect.ValueOf( function )
+    if value.Kind() != reflect.Func || value.IsNil() {
+        return ""
+    }
+    if fn := runtime.FuncForPC( value.Pointer() ); fn != nil {
+        return fn.Name()
+    }
+    return ""
+}
@@ -0,0 +1,127 @@
+/*
+    JSON - responses, request body binding and `application/problem+json` errors for APIs
+
+    (c)copyright 2021 by Gerald Wodni <gerald.wodni@gmail.com>
+*/
+package router
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "mime"
+    "net/http"
+    "strings"
+
+    "github.com/GeraldWodni/kern.go/log"
+)
+
+// Maximum size of request bodies accepted by `BindJSON`
+var MaxJSONBody int64 = 1 << 20
+
+// Error returned by `BindJSON`, `Status` is the matching response status
+type BindError struct {
+    Status int
+    Err error
+}
+
+func (err *BindError) Error() string {
+    return err.Err.Error()
+}
+
+func (err *BindError) Unwrap() error {
+    return err.Err
+}
+
+func (err *BindError) StatusCode() int {
+    return err.Status
+}
+
+// Status carried by `err` (i.e. a `BindError`), `fallback` for all other errors
+func ErrorStatus( err error, fallback int ) int {
+    var statusErr interface{ StatusCode() int }
+    if errors.As( err, &statusErr ) {
+        return statusErr.StatusCode()
+    }
+    return fallback
+}
+
+// Respond with `v` encoded as JSON
+// Hint: `v` is encoded before any header is written, failures result in a plain 500
+func JSON( res http.ResponseWriter, req *http.Request, status int, v interface{} ) {
+    body, err := json.Marshal( v )
+    if err != nil {
+        log.Of( req ).Error( "Router JSON:", err )
+        body, _ = json.Marshal( Problem{
+            Type: "about:blank",
+            Title: http.StatusText( http.StatusInternalServerError ),
+            Status: http.StatusInternalServerError,
+        })
+        res.Header().Set( "Content-Type", "application/problem+json" )
+        res.WriteHeader( http.StatusInternalServerError )
+        res.Write( body )
+        return
+    }
+    res.Header().Set( "Content-Type", "application/json; charset=utf-8" )
+    res.WriteHeader( status )
+    res.Write( append( body, '\n' ) )
+}
+
+// Respond with `application/problem+json` regardless of the `Accept` header, meant for API routes
+func JSONError( res http.ResponseWriter, req *http.Request, status int, err error ) {
+    if err != nil && status >= 500 {
+        log.Of( req ).Error( err )
+    }
+    problemJSON( res, req, status, err )
+}
+
+// Decode JSON body of `req` into `v`, rejects unknown fields, trailing data and bodies larger than `MaxJSONBody`
+// Example:
+//     if err := router.BindJSON( req, &item ); err != nil {
+//         router.JSONError( res, req, router.ErrorStatus( err, http.StatusBadRequest ), err )
+//         return
+//     }
+func BindJSON( req *http.Request, v interface{} ) error {
+    if contentType := req.Header.Get( "Content-Type" ); contentType != "" {
+        mediaType, _, err := mime.ParseMediaType( contentType )
+        if err != nil || ( mediaType != "application/json" && !strings.HasSuffix( mediaType, "+json" ) ) {
+            return &BindError{ http.StatusUnsupportedMediaType, fmt.Errorf( "Content-Type %s is not JSON", contentType ) }
+        }
+    }
+    if req.Body == nil {
+        return &BindError{ http.StatusBadRequest, errors.New( "request body is empty" ) }
+    }
+
+    decoder := json.NewDecoder( http.MaxBytesReader( nil, req.Body, MaxJSONBody ) )
+    decoder.DisallowUnknownFields()
+    if err := decoder.Decode( v ); err != nil {
+        return bindError( err )
+    }
+    if err := decoder.Decode( &struct{}{} ); err != io.EOF {
+        if err == nil {
+            err = errors.New( "request body must contain a single JSON value" )
+        }
+        return bindError( err )
+    }
+    return nil
+}
+
+func bindError( err error ) *BindError {
+    var maxBytesErr *http.MaxBytesError
+    var syntaxErr *json.SyntaxError
+    var typeErr *json.UnmarshalTypeError
+    switch {
+        case errors.As( err, &maxBytesErr ):
+            return &BindError{ http.StatusRequestEntityTooLarge, fmt.Errorf( "request body exceeds %d bytes", maxBytesErr.Limit ) }
+        case errors.Is( err, io.EOF ):
+            return &BindError{ http.StatusBadRequest, errors.New( "request body is empty" ) }
+        case errors.Is( err, io.ErrUnexpectedEOF ):
+            return &BindError{ http.StatusBadRequest, errors.New( "request body contains incomplete JSON" ) }
+        case errors.As( err, &syntaxErr ):
+            return &BindError{ http.StatusBadRequest, fmt.Errorf( "request body contains invalid JSON at offset %d", syntaxErr.Offset ) }
+        case errors.As( err, &typeErr ):
+            return &BindError{ http.StatusBadRequest, fmt.Errorf( "field '%s' must be of type %s", typeErr.Field, typeErr.Type ) }
+    }
+    return &BindError{ http.StatusBadRequest, err }
+}
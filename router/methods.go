@@ -0,0 +1,168 @@
+/*
+    Method semantics - `405 Method Not Allowed`, automatic `OPTIONS`, `HEAD` served by `GET` handlers
+    and method override for HTML forms
+
+    (c)copyright 2021 by Gerald Wodni <gerald.wodni@gmail.com>
+*/
+package router
+
+import (
+    "context"
+    "fmt"
+    "net/http"
+    "sort"
+    "strings"
+)
+
+const stateContextId = contextType(45) // internal context key
+
+// per request routing state, shared by all nested routers
+type requestState struct {
+    // router served via `ServeHTTP`
+    router *Router
+    // methods of routes which fully matched the path but not the method
+    allowed map[string]bool
+    // routes tried, nil unless tracing
+    trace []TraceEntry
+    // set by `OverrideMethod`
+    method string
+    originalMethod string
+    // closed once handlers which overran their `Route.Timeout` return, see `ServeHTTP`
+    overrunning []chan struct{}
+}
+
+func withState( req *http.Request, router *Router ) *http.Request {
+    state := &requestState{
+        router: router,
+        allowed: make(map[string]bool),
+    }
+    ctx := context.WithValue( req.Context(), stateContextId, state )
+    return req.WithContext( ctx )
+}
+
+func stateOf( req *http.Request ) (state *requestState, ok bool) {
+    state, ok = req.Context().Value( stateContextId ).(*requestState)
+    return
+}
+
+// Methods which can be requested via `MethodOverride`
+var OverridableMethods = []string{ http.MethodPut, http.MethodPatch, http.MethodDelete }
+
+// Opt-in middleware: `POST` requests may ask for another method via a hidden `_method` form field or the `X-HTTP-Method-Override` header,
+// attach via `router.Use( router.MethodOverride )`
+// Example:
+//     <form method="post"><input type="hidden" name="_method" value="DELETE"/></form>
+func MethodOverride( res http.ResponseWriter, req *http.Request, next MiddlewareNext ) {
+    if req.Method == http.MethodPost {
+        method := req.Header.Get( "X-HTTP-Method-Override" )
+        if method == "" {
+            method = req.PostFormValue( "_method" )
+        }
+        method = strings.ToUpper( method )
+        for _, overridable := range OverridableMethods {
+            if method == overridable {
+                OverrideMethod( req, method )
+                break
+            }
+        }
+    }
+    next( res, req )
+}
+
+// Continue routing `req` as `method`, i.e. as `GET` after a successful login `POST`
+func OverrideMethod( req *http.Request, method string ) {
+    if state, ok := stateOf( req ); ok {
+        if state.originalMethod == "" {
+            state.originalMethod = req.Method
+        }
+        state.method = method
+    }
+    req.Method = method
+}
+
+// get method as sent by the client, before any `OverrideMethod`
+func OriginalMethod( req *http.Request ) string {
+    if state, ok := stateOf( req ); ok && state.originalMethod != "" {
+        return state.originalMethod
+    }
+    return req.Method
+}
+
+// method used for routing, copies of `req` share overrides via the request state
+func routingMethod( req *http.Request ) string {
+    if state, ok := stateOf( req ); ok && state.method != "" {
+        return state.method
+    }
+    return req.Method
+}
+
+// check if route accepts `method`, `HEAD` is served by `GET` routes
+func (route *Route) acceptsMethod( method string ) bool {
+    return route.Method == "ALL" || route.Method == method || ( method == http.MethodHead && route.Method == http.MethodGet )
+}
+
+// check if the route's pattern covers all of `parts` (not only a prefix of them)
+func (route *Route) matchesFully( parts []string ) bool {
+    segments := route.compiled()
+    if len( segments ) > 0 && segments[ len(segments)-1 ].Type == wildcardSegment {
+        return true
+    }
+    return len( segments ) == len( parts )
+}
+
+// remember method of a route which would have matched
+func (state *requestState) allow( method string ) {
+    state.allowed[ method ] = true
+    if method == http.MethodGet {
+        state.allowed[ http.MethodHead ] = true
+    }
+}
+
+// value for the `Allow` header, empty if no route matched the path
+func (state *requestState) allowHeader() string {
+    if len( state.allowed ) == 0 {
+        return ""
+    }
+    methods := []string{ http.MethodOptions }
+    for method := range state.allowed {
+        if method != http.MethodOptions {
+            methods = append( methods, method )
+        }
+    }
+    sort.Strings( methods )
+    return strings.Join( methods, ", " )
+}
+
+// Answer unhandled requests whose path matched a route: `OPTIONS` lists the allowed methods, all others get a `405`
+func methodFallback( res http.ResponseWriter, req *http.Request ) (handled bool) {
+    state, ok := stateOf( req )
+    if !ok {
+        return
+    }
+    allow := state.allowHeader()
+    if allow == "" {
+        return
+    }
+
+    method := routingMethod( req )
+    res.Header().Set( "Allow", allow )
+    if method == http.MethodOptions {
+        res.WriteHeader( http.StatusNoContent )
+        return true
+    }
+    Error( res, req, http.StatusMethodNotAllowed, fmt.Errorf( "Method %s not allowed, use %s", method, allow ) )
+    return true
+}
+
+// discards the body of `HEAD` responses but keeps headers and status
+type headResponseWriter struct {
+    http.ResponseWriter
+}
+
+func (res headResponseWriter) Write( b []byte ) (int, error) {
+    return len( b ), nil
+}
+
+func (res headResponseWriter) Unwrap() http.ResponseWriter {
+    return res.ResponseWriter
+}
@@ -0,0 +1,136 @@
+/*
+    Route patterns - segment aware matching with named parameters (`/user/:id`) and wildcards (`/files/*rest`)
+
+    (c)copyright 2021 by Gerald Wodni <gerald.wodni@gmail.com>
+*/
+package router
+
+import (
+    "context"
+    "fmt"
+    "net/http"
+    "strings"
+)
+
+// Values captured by `:name` and `*name` segments of a `Route.Path`
+type Params map[string]string
+
+type segmentType int
+const (
+    staticSegment segmentType = iota
+    paramSegment
+    wildcardSegment
+)
+
+type segment struct {
+    Type segmentType
+    // literal text for static segments, parameter name otherwise
+    Name string
+}
+
+type contextType int; const paramsContextId = contextType(42) // internal context key
+
+// split path into its non-empty segments
+func splitPath( path string ) (parts []string) {
+    parts = []string{}
+    for _, part := range strings.Split( path, "/" ) {
+        if part != "" {
+            parts = append( parts, part )
+        }
+    }
+    return
+}
+
+// compile `path` into segments, a wildcard swallows everything after it
+// Hint: panics on unnamed parameters and on segments after a wildcard, as those would never match
+func compilePattern( path string ) (segments []segment) {
+    segments = []segment{}
+    parts := splitPath( path )
+    for i, part := range parts {
+        if ( part[0] == ':' || part[0] == '*' ) && len( part ) == 1 {
+            panic( fmt.Sprintf( "router: unnamed parameter in %q", path ) )
+        }
+        switch part[0] {
+            case ':':
+                segments = append( segments, segment{ Type: paramSegment, Name: part[1:] } )
+            case '*':
+                if i < len( parts )-1 {
+                    panic( fmt.Sprintf( "router: segments after wildcard in %q", path ) )
+                }
+                segments = append( segments, segment{ Type: wildcardSegment, Name: part[1:] } )
+                return
+            default:
+                segments = append( segments, segment{ Type: staticSegment, Name: part } )
+        }
+    }
+    return
+}
+
+// patterns with parameters only match their full path, static ones also match everything below them unless `Exact` is set.
+// A trailing wildcard and mounted routers always match everything below.
+func (route *Route) matchesExactly() bool {
+    if route.exact {
+        return true
+    }
+    if route.mounted != nil {
+        return false
+    }
+    exact := false
+    for _, seg := range route.compiled() {
+        switch seg.Type {
+            case paramSegment:
+                exact = true
+            case wildcardSegment:
+                return false
+        }
+    }
+    return exact
+}
+
+// Only handle the route's full path, i.e. `router.Get( "/", handler ).Exact()` does not serve `/about`
+func (route *Route) Exact() *Route {
+    route.router.treeMutex.Lock()
+    defer route.router.treeMutex.Unlock()
+    route.exact = true
+    route.router.tree = nil
+    return route
+}
+
+func setParam( params Params, name string, value string ) Params {
+    if params == nil {
+        params = Params{}
+    }
+    params[ name ] = value
+    return params
+}
+
+// add `params` to request-context, keeping those of enclosing routers
+func withParams( req *http.Request, params Params ) *http.Request {
+    if len( params ) == 0 {
+        return req
+    }
+    merged := Params{}
+    for name, value := range ParamsOf( req ) {
+        merged[ name ] = value
+    }
+    for name, value := range params {
+        merged[ name ] = value
+    }
+    ctx := context.WithValue( req.Context(), paramsContextId, merged )
+    return req.WithContext( ctx )
+}
+
+// get all route parameters from request-context
+func ParamsOf( req *http.Request ) (params Params) {
+    params, ok := req.Context().Value( paramsContextId ).(Params)
+    if !ok {
+        params = Params{}
+    }
+    return
+}
+
+// get named route parameter from request-context
+// i.e. `router.Param( req, "id" )` for a route added as `/user/:id`
+func Param( req *http.Request, name string ) string {
+    return ParamsOf( req )[ name ]
+}
@@ -0,0 +1,57 @@
+/*
+    Panic recovery - a panicking handler is logged and answered with a status 500 error page
+
+    (c)copyright 2021 by Gerald Wodni <gerald.wodni@gmail.com>
+*/
+package router
+
+import (
+    "fmt"
+    "net/http"
+    "os"
+    "runtime/debug"
+
+    "github.com/GeraldWodni/kern.go/log"
+)
+
+// Development mode exposes details like stack traces on error pages, set via `KERN_DEVELOPMENT=true`
+var Development = os.Getenv("KERN_DEVELOPMENT") == "true"
+
+// Render an error page for `status`, `err` may be nil. See `Error` and `view.ErrorHandler`
+type ErrorHandler func( res http.ResponseWriter, req *http.Request, status int, err error )
+
+// Recovered panic of a RouteHandler
+type PanicError struct {
+    Value interface{}
+    Stack []byte
+}
+
+func (err *PanicError) Error() string {
+    return fmt.Sprintf( "panic: %v", err.Value )
+}
+
+// serve `req` and turn panics into a status 500
+func (router *Router) serveRecover( res http.ResponseWriter, req *http.Request, next MiddlewareNext ) {
+    defer func() {
+        recovered := recover()
+        if recovered == nil {
+            return
+        }
+        // `http.Server` uses this value to silently abort the response
+        if recovered == http.ErrAbortHandler {
+            panic( recovered )
+        }
+
+        // already wrapped when recovered in the goroutine of a `Route.Timeout` handler
+        panicErr, ok := recovered.(*PanicError)
+        if !ok {
+            panicErr = &PanicError{
+                Value: recovered,
+                Stack: debug.Stack(),
+            }
+        }
+        log.Of( req ).Error( "Router recovered", panicErr, "\n" + string( panicErr.Stack ) )
+        Error( res, req, http.StatusInternalServerError, panicErr )
+    }()
+    router.serve( res, req, next )
+}
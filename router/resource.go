@@ -0,0 +1,157 @@
+/*
+    Resources - conventional CRUD routes for a controller, rendered as views or JSON depending on the `Accept` header
+
+    (c)copyright 2021 by Gerald Wodni <gerald.wodni@gmail.com>
+*/
+package router
+
+import (
+    "net/http"
+    "net/url"
+    gopath "path"
+    "strings"
+)
+
+// Renders view `name` (i.e. `items/index`) with `locals`, set as `Router.Renderer`; see `view.Renderer`
+type Renderer func( res http.ResponseWriter, req *http.Request, status int, name string, locals interface{} )
+
+// Controller actions, a controller passed to `Resource` implements any subset of them.
+// The item id is available via `router.Param( req, "id" )`, returned errors implementing `StatusCode() int` (i.e. `StatusError`) set the response status.
+type ResourceIndexer interface {
+    // `GET /items`, renders `items/index`
+    Index( req *http.Request ) (locals interface{}, err error)
+}
+type ResourceShower interface {
+    // `GET /items/:id`, renders `items/show`
+    Show( req *http.Request ) (locals interface{}, err error)
+}
+type ResourceNewer interface {
+    // `GET /items/new`, renders `items/new`
+    New( req *http.Request ) (locals interface{}, err error)
+}
+type ResourceCreator interface {
+    // `POST /items`, redirects to `/items` or responds `201 Created` with the returned JSON
+    Create( req *http.Request ) (result interface{}, err error)
+}
+type ResourceEditor interface {
+    // `GET /items/:id/edit`, renders `items/edit`
+    Edit( req *http.Request ) (locals interface{}, err error)
+}
+type ResourceUpdater interface {
+    // `PUT` or `PATCH /items/:id`, redirects to `/items/:id` or responds with the returned JSON
+    Update( req *http.Request ) (result interface{}, err error)
+}
+type ResourceDestroyer interface {
+    // `DELETE /items/:id`, redirects to `/items` or responds `204 No Content`
+    Destroy( req *http.Request ) (result interface{}, err error)
+}
+
+type resourceAction func( req *http.Request ) (interface{}, error)
+
+// Mount router on `path` with the conventional routes for all actions implemented by `controller`.
+// Routes are named after the last segment of `path`, i.e. `items`, `items.new`, `items.show` and `items.edit`.
+// Hint: the router uses `MethodOverride`, so HTML forms can `PUT` and `DELETE` via `_method`
+func (router *Router) Resource( path string, controller interface{} ) (resourceRouter *Router) {
+    name := gopath.Base( path )
+    resourceRouter = router.NewMounted( path )
+    resourceRouter.Name = name
+    resourceRouter.Use( MethodOverride )
+
+    // resolved per request, enclosing routers might get mounted later
+    base := &Route{ Path: resourceRouter.routePath( "/" ), router: resourceRouter }
+    redirectIndex := func( req *http.Request ) string {
+        return base.FullPath()
+    }
+    redirectShow := func( req *http.Request ) string {
+        return gopath.Join( base.FullPath(), url.PathEscape( Param( req, "id" ) ) )
+    }
+
+    // resource actions only handle their full path, `/` and `/new` must not serve paths below them
+    if indexer, ok := controller.(ResourceIndexer); ok {
+        resourceRouter.Get( "/", resourceView( name + "/index", indexer.Index ) ).Exact().Name( name )
+    }
+    if newer, ok := controller.(ResourceNewer); ok {
+        resourceRouter.Get( "/new", resourceView( name + "/new", newer.New ) ).Exact().Name( name + ".new" )
+    }
+    if creator, ok := controller.(ResourceCreator); ok {
+        resourceRouter.Post( "/", resourceChange( http.StatusCreated, redirectIndex, creator.Create ) ).Exact()
+    }
+    if shower, ok := controller.(ResourceShower); ok {
+        resourceRouter.Get( "/:id", resourceView( name + "/show", shower.Show ) ).Name( name + ".show" )
+    }
+    if editor, ok := controller.(ResourceEditor); ok {
+        resourceRouter.Get( "/:id/edit", resourceView( name + "/edit", editor.Edit ) ).Name( name + ".edit" )
+    }
+    if updater, ok := controller.(ResourceUpdater); ok {
+        for _, method := range []string{ http.MethodPut, http.MethodPatch } {
+            resourceRouter.Add( method, "/:id", resourceChange( http.StatusOK, redirectShow, updater.Update ) )
+        }
+    }
+    if destroyer, ok := controller.(ResourceDestroyer); ok {
+        resourceRouter.Delete( "/:id", resourceChange( http.StatusNoContent, redirectIndex, destroyer.Destroy ) )
+    }
+    return
+}
+
+// render `locals` of `action` via the root router's `Renderer`, JSON if preferred by the client or no `Renderer` is set
+func resourceView( name string, action resourceAction ) RouteHandler {
+    return func( res http.ResponseWriter, req *http.Request, next RouteNext ) {
+        locals, err := action( req )
+        if err != nil {
+            resourceError( res, req, err )
+            return
+        }
+        renderer := RendererOf( req )
+        if PrefersJSON( req ) || renderer == nil {
+            JSON( res, req, http.StatusOK, locals )
+            return
+        }
+        renderer( res, req, http.StatusOK, name, locals )
+    }
+}
+
+// `Renderer` of the root router serving `req`, nil if none is set
+func RendererOf( req *http.Request ) Renderer {
+    if state, ok := stateOf( req ); ok && state.router != nil {
+        return state.router.Renderer
+    }
+    return nil
+}
+
+// run `action`, answer JSON clients with its result and redirect all others (Post/Redirect/Get)
+func resourceChange( status int, redirect func( *http.Request ) string, action resourceAction ) RouteHandler {
+    return func( res http.ResponseWriter, req *http.Request, next RouteNext ) {
+        result, err := action( req )
+        if err != nil {
+            resourceError( res, req, err )
+            return
+        }
+        if acceptsHtml( req ) {
+            http.Redirect( res, req, redirect( req ), http.StatusSeeOther )
+            return
+        }
+        if status == http.StatusNoContent || result == nil {
+            res.WriteHeader( http.StatusNoContent )
+            return
+        }
+        JSON( res, req, status, result )
+    }
+}
+
+func resourceError( res http.ResponseWriter, req *http.Request, err error ) {
+    status := ErrorStatus( err, http.StatusInternalServerError )
+    if !acceptsHtml( req ) {
+        JSONError( res, req, status, err )
+        return
+    }
+    Error( res, req, status, err )
+}
+
+// browsers submitting forms accept html, API clients send JSON or prefer it
+func acceptsHtml( req *http.Request ) bool {
+    if PrefersJSON( req ) {
+        return false
+    }
+    contentType := req.Header.Get( "Content-Type" )
+    return !strings.HasPrefix( contentType, "application/json" ) && !strings.HasSuffix( strings.SplitN( contentType, ";", 2 )[0], "+json" )
+}
@@ -9,12 +9,17 @@
 package router
 
 import (
+    "context"
     gopath "path"
     "fmt"
-    "io/ioutil"
+    "html"
     "mime"
     "net/http"
+    "os"
+    "path/filepath"
     "strings"
+    "sync"
+    "time"
 
     "github.com/GeraldWodni/kern.go/hierarchy"
     "github.com/GeraldWodni/kern.go/log"
@@ -27,18 +32,60 @@ type RouteNext func()
 // Extend the (res, req) handler interface with a resume-route callback
 type RouteHandler func (res http.ResponseWriter, req *http.Request, next RouteNext )
 
+// Continue with the wrapped handling, `res` and `req` may be replaced i.e. by a `context` enriched request
+type MiddlewareNext func( res http.ResponseWriter, req *http.Request )
+
+// Wraps the handling of a router and its mounted children.
+// Code before `next` runs before any route, code after `next` once routing has returned; not calling `next` stops routing.
+type Middleware func( res http.ResponseWriter, req *http.Request, next MiddlewareNext )
+
 type Route struct {
     Method string
+    // segment aware pattern, supports named parameters `/user/:id` and wildcards `/files/*rest`
     Path string
     Handler RouteHandler
+    segments []segment
+    // optional name for `URLFor`
+    name string
+    // optional `Cache-Control` for static files
+    cachePolicy *CachePolicy
+    // set for routes added by `Mount`
+    mounted *Router
+    router *Router
+    // see `Timeout`
+    timeout time.Duration
+    // only match the full path, see `Exact`
+    exact bool
 }
 
 type Router struct {
     // optionally identify router per name
     Name string
     MountPoint string
-    Routes []Route
+    // opt-in express-style mounting: handlers see `req.URL.Path` relative to `MountPoint`,
+    // use `OriginalPath` and `BaseURL` to get the full picture
+    StripPrefix bool
+    Routes []*Route
+    Middlewares []Middleware
+    // called when no route handled the request, only used when served directly (mounted routers fall through to their parent)
     NotFoundHandler RouteHandler
+    // renders error pages for `Error`, i.e. 404 and 500 after a panic, only used when served directly
+    ErrorHandler ErrorHandler
+    // renders views of `Resource` controllers, only used when served directly
+    Renderer Renderer
+    // log all routes tried per request, see `TraceOf`; only used when served directly
+    Trace bool
+    // compiled lazily from `Routes`, reset by `Add`
+    tree *node
+    treeRoutes []*Route
+    treeMutex sync.Mutex
+    // set by `Mount`, used by `URLFor`
+    parent *Router
+    parentMountPoint string
+    // named routes of this router and all mounted ones, rebuilt when `namesGeneration` changes
+    names map[string]*Route
+    namesBuilt int64
+    namesMutex sync.Mutex
 }
 
 // New router with it's mountpoint fixed.
@@ -46,7 +93,7 @@ type Router struct {
 func New( mountPoint string ) (router *Router) {
     router = &Router{
         MountPoint: mountPoint,
-        Routes: make([]Route, 0),
+        Routes: make([]*Route, 0),
         NotFoundHandler: nil,
     }
     return
@@ -54,135 +101,348 @@ func New( mountPoint string ) (router *Router) {
 
 // Gets called by `http`, not to be used by app
 func (router *Router) ServeHTTP(res http.ResponseWriter, req *http.Request) {
-    req, ok := module.ExecuteStartRequest( res, req )
+    // status and size for modules like `accesslog`, see `StatusOf`
+    res = NewStatusWriter( res )
+    if req.Method == http.MethodHead {
+        res = headResponseWriter{ res }
+    }
+    req, ok := module.ExecuteStartRequest( res, withState( req, router ) )
+    if state, _ := stateOf( req ); state != nil && router.Trace {
+        state.trace = []TraceEntry{}
+        defer logTrace( req )
+    }
     if ok {
-        router.serve( res, req )
+        // unhandled requests fall through with `res` and `req` as passed on by the middlewares
+        router.serveRecover( res, req, func( res http.ResponseWriter, req *http.Request ) {
+            if !methodFallback( res, req ) {
+                router.notFound( res, req )
+            }
+        })
+        // always reached, even after a panic, so modules can release their resources
+        if state, _ := stateOf( req ); state != nil && len( state.overrunning ) > 0 {
+            // handlers past their `Route.Timeout` still use the session and redis connection of `req`
+            go func() {
+                for _, done := range state.overrunning {
+                    <-done
+                }
+                module.ExecuteEndRequest( res, req )
+            }()
+            return
+        }
         module.ExecuteEndRequest( res, req )
     }
 }
 
-func (router *Router) serve(res http.ResponseWriter, req *http.Request) {
-    for _, route := range router.Routes {
-        if (route.Method == "ALL" || req.Method == route.Method ) && strings.HasPrefix( req.URL.Path, route.Path ) {
-            resume := false
-            route.Handler( res, req, func() {
-                resume = true
-            })
-            if resume == false {
-                return
+// Route `req` through middlewares and routes, `next` is called with the middlewares' `res` and `req` when no route handled the request.
+// Hint: `next` is passed per request so a router can be shared by concurrent requests and multiple parents
+func (router *Router) serve(res http.ResponseWriter, req *http.Request, next MiddlewareNext) {
+    router.serveMiddleware( 0, res, req, next )
+}
+func (router *Router) serveMiddleware( index int, res http.ResponseWriter, req *http.Request, next MiddlewareNext ) {
+    if index < len( router.Middlewares ) {
+        router.Middlewares[ index ]( res, req, func( res http.ResponseWriter, req *http.Request ) {
+            router.serveMiddleware( index+1, res, req, next )
+        })
+        return
+    }
+    router.serveRoutes( res, req, next )
+}
+func (router *Router) serveRoutes(res http.ResponseWriter, req *http.Request, next MiddlewareNext) {
+    parts := splitPath( req.URL.Path )
+    tree, routes := router.compile()
+    state, _ := stateOf( req )
+    for _, index := range tree.lookup( parts ) {
+        route := routes[ index ]
+        // evaluated per route as handlers may `OverrideMethod`
+        if !route.acceptsMethod( routingMethod( req ) ) {
+            if state != nil && route.Method != "ALL" && route.matchesFully( parts ) {
+                state.allow( route.Method )
             }
+            continue
+        }
+        params := extractParams( route.compiled(), parts )
+        traceIndex := -1
+        if state != nil && state.trace != nil {
+            traceIndex = state.traceRoute( router, route )
+        }
+        resume := false
+        route.serve( res, withParams( req, params ), func() {
+            resume = true
+        })
+        if traceIndex >= 0 {
+            state.trace[ traceIndex ].Resumed = resume
+        }
+        if resume == false {
+            return
         }
     }
+    next( res, req )
+}
+func (router *Router) notFound(res http.ResponseWriter, req *http.Request) {
     if router.NotFoundHandler != nil {
         router.NotFoundHandler( res, req, nil )
     } else {
-        notFound( res, "kern.go: set Router.NotFoundHandler( res, req, next ) to display a custom response" )
+        Error( res, req, http.StatusNotFound, nil )
     }
 }
 
+// get route tree, compile it if routes have changed
+func (router *Router) compile() (tree *node, routes []*Route) {
+    router.treeMutex.Lock()
+    defer router.treeMutex.Unlock()
+    if router.tree == nil || len( router.treeRoutes ) != len( router.Routes ) {
+        router.treeRoutes = router.Routes[:len( router.Routes ):len( router.Routes )]
+        router.tree = buildTree( router.treeRoutes )
+    }
+    return router.tree, router.treeRoutes
+}
+
+// segments of the route's pattern
+func (route *Route) compiled() []segment {
+    if route.segments == nil {
+        route.segments = compilePattern( route.Path )
+    }
+    return route.segments
+}
+
 // Add RouteHandler with explicit method mounted at `path`. Use `All`, `Get` OR `Post` unless crazy methods are required
-func (router *Router) Add( method string, path string, handler RouteHandler ) {
-    mountPath := gopath.Join( router.MountPoint, path )
+// `path` matches whole segments only and may contain named parameters and a trailing wildcard, i.e. `/user/:id` or `/files/*rest`,
+// captured values are available via `router.Param( req, "id" )`.
+// Static paths match as prefix (`/admin` also handles `/admin/users`) unless `Route.Exact` is set, paths with parameters only match in full (`/user/:id` does not handle `/user/5/edit`)
+// and a trailing wildcard matches everything below.
+// Hint: `path` is joined with `MountPoint` unless `StripPrefix` is set
+func (router *Router) Add( method string, path string, handler RouteHandler ) *Route {
+    mountPath := router.routePath( path )
     log.Debugf( "Router %s handles %s (%s)", router.MountPoint, path, mountPath )
-
-    route := Route{
+    return router.addRoute( method, mountPath, handler )
+}
+func (router *Router) addRoute( method string, path string, handler RouteHandler ) (route *Route) {
+    route = &Route{
         Method: method,
-        // TODO: evaluate wether joined Path is cool or a express-based prefix removal is nicer
-        Path: mountPath,
+        Path: path,
         Handler: handler,
+        segments: compilePattern( path ),
+        router: router,
     }
+    router.treeMutex.Lock()
+    defer router.treeMutex.Unlock()
     router.Routes = append( router.Routes, route )
+    router.tree = nil
+    namesGeneration.Add( 1 )
+    return
+}
+// path as seen by this router's handlers
+func (router *Router) routePath( path string ) string {
+    if router.StripPrefix {
+        return gopath.Join( "/", path )
+    }
+    return gopath.Join( router.MountPoint, path )
 }
-// Render an `error` as status code 500
+// Render an `error` as status code 500 without any error page, prefer `Error` when `req` is available
+// Hint: logs with the request id echoed in the response header by the `requestid` module
 func Err( res http.ResponseWriter, err error ) {
-    res.WriteHeader(500)
+    renderErr( res, err )
+    log.OfResponse( res ).Error( err )
+}
+// Like `Err` but logs with the request id, i.e. when the error page itself failed
+func ErrReq( res http.ResponseWriter, req *http.Request, err error ) {
+    renderErr( res, err )
+    log.Of( req ).Error( err )
+}
+func renderErr( res http.ResponseWriter, err error ) {
     res.Header().Set("Content-Type", "text/html; charset=utf-8")
-    fmt.Fprintf( res, "<h1>Error</h1><pre>" )
-    fmt.Fprintf( res, err.Error() )
-    fmt.Fprintf( res, "</pre>" )
-    log.Error( err )
+    res.WriteHeader(500)
+    fmt.Fprintf( res, "<h1>Error</h1><pre>%s</pre>", html.EscapeString( ErrorMessage( 500, err ) ) )
 }
-// Wrapper for Err, provides a RouteHandler for convenience
+// Wrapper for Error with status 500, provides a RouteHandler for convenience
 // see view/view.go for example usage
 func ErrHandler( err error ) RouteHandler {
     return func( res http.ResponseWriter, req *http.Request, next RouteNext ) {
-        Err( res, err )
+        Error( res, req, http.StatusInternalServerError, err )
     }
 }
 // Match all methods on `path`
-func (router *Router) All( path string, handler RouteHandler ) {
-    router.Add( "ALL", path, handler )
+func (router *Router) All( path string, handler RouteHandler ) *Route {
+    return router.Add( "ALL", path, handler )
 }
 // Match all `GET` requests on `path`
-func (router *Router) Get( path string, handler RouteHandler ) {
-    router.Add( http.MethodGet, path, handler )
+func (router *Router) Get( path string, handler RouteHandler ) *Route {
+    return router.Add( http.MethodGet, path, handler )
 }
 // Match all `POST` requests on `path`
-func (router *Router) Post( path string, handler RouteHandler ) {
-    router.Add( http.MethodPost, path, handler )
+func (router *Router) Post( path string, handler RouteHandler ) *Route {
+    return router.Add( http.MethodPost, path, handler )
+}
+// Match all `PUT` requests on `path`
+func (router *Router) Put( path string, handler RouteHandler ) *Route {
+    return router.Add( http.MethodPut, path, handler )
+}
+// Match all `PATCH` requests on `path`
+func (router *Router) Patch( path string, handler RouteHandler ) *Route {
+    return router.Add( http.MethodPatch, path, handler )
+}
+// Match all `DELETE` requests on `path`
+func (router *Router) Delete( path string, handler RouteHandler ) *Route {
+    return router.Add( http.MethodDelete, path, handler )
+}
+// Match all `HEAD` requests on `path`
+// Hint: only needed for special treatment, `Get` routes answer `HEAD` requests without a body
+func (router *Router) Head( path string, handler RouteHandler ) *Route {
+    return router.Add( http.MethodHead, path, handler )
 }
 // Mount router created by `New` on existing router i.e. `app.Router`
+// Hint: a `subRouter` with `StripPrefix` is mounted relative to `router`, otherwise its `MountPoint` is used as is
 func (router *Router) Mount( subRouter *Router ) {
-    mountPoint := gopath.Join( router.MountPoint, subRouter.MountPoint )
-    router.All( mountPoint, func( res http.ResponseWriter, req *http.Request, next RouteNext ) {
-        subRouter.NotFoundHandler = func( _ http.ResponseWriter, _ *http.Request, _ RouteNext ) {
-            next()
+    mountPoint := subRouter.MountPoint
+    if subRouter.StripPrefix {
+        mountPoint = router.routePath( mountPoint )
+    }
+    subRouter.parent = router
+    subRouter.parentMountPoint = mountPoint
+    route := router.addRoute( "ALL", mountPoint, func( res http.ResponseWriter, req *http.Request, next RouteNext ) {
+        if subRouter.StripPrefix {
+            req = stripPrefix( req, mountPoint )
         }
-        subRouter.serve( res, req )
+        // the parent continues with its own `res` and `req`
+        subRouter.serve( res, req, func( http.ResponseWriter, *http.Request ) {
+            next()
+        })
     })
+    route.mounted = subRouter
+    namesGeneration.Add( 1 )
 }
-// Wrapper to create a mounted router.
+// Attach `middleware` to this router, it wraps all routes including those of mounted routers.
+// Middlewares run in the order they were added; use `module.RegisterRequest` for global modules.
+func (router *Router) Use( middleware Middleware ) {
+    router.Middlewares = append( router.Middlewares, middleware )
+}
+// Wrapper to create a mounted router, `StripPrefix` is inherited.
 // Hint: use when implementing a simple tree-navigation in an app
 func (router *Router) NewMounted( mountPoint string ) (subRouter *Router) {
-    subRouter = New( mountPoint )
+    if router.StripPrefix {
+        subRouter = New( mountPoint )
+        subRouter.StripPrefix = true
+    } else {
+        subRouter = New( router.routePath( mountPoint ) )
+    }
     router.Mount( subRouter )
     return
 }
 
-// Provide a static file.
-// Kern automatically provides a favicon via this function:
-//     kern.Router.StaticFile( "/favicon.ico", "image/x-icon", "./default/images/favicon.ico" )
-func (router *Router) StaticFile( path string, contentType string, filename string ) {
-    router.Get( path, func( res http.ResponseWriter, req *http.Request, next RouteNext ) {
-        serveFile( res, contentType, filename )
-    })
+const originalPathContextId = contextType(43) // internal context key
+const baseUrlContextId = contextType(44) // internal context key
+
+// remove the segments matched by `mountPoint` from `req.URL.Path`, remember original path and base
+func stripPrefix( req *http.Request, mountPoint string ) *http.Request {
+    originalPath := OriginalPath( req )
+    parts := splitPath( req.URL.Path )
+    depth := 0
+    for _, seg := range compilePattern( mountPoint ) {
+        if seg.Type == wildcardSegment {
+            depth = len( parts )
+            break
+        }
+        depth++
+    }
+    if depth > len( parts ) {
+        depth = len( parts )
+    }
+
+    base := BaseURL( req ) + "/" + strings.Join( parts[:depth], "/" )
+    path := "/" + strings.Join( parts[depth:], "/" )
+    if depth < len( parts ) && strings.HasSuffix( req.URL.Path, "/" ) {
+        path += "/"
+    }
+
+    ctx := context.WithValue( req.Context(), originalPathContextId, originalPath )
+    ctx = context.WithValue( ctx, baseUrlContextId, strings.TrimSuffix( base, "/" ) )
+    stripped := req.WithContext( ctx )
+    url := *req.URL
+    url.Path = path
+    url.RawPath = ""
+    stripped.URL = &url
+    return stripped
 }
-func serveFile( res http.ResponseWriter, contentType string, filename string ) {
-    content, err := ioutil.ReadFile( filename )
-    if err != nil {
-        Err( res, err )
-        return
+
+// get `req.URL.Path` before any mounted router stripped its prefix
+func OriginalPath( req *http.Request ) string {
+    if path, ok := req.Context().Value( originalPathContextId ).(string); ok {
+        return path
     }
+    return req.URL.Path
+}
 
-    res.Header().Set( "Content-Type", contentType )
-    res.Write( content )
+// get path the current router is mounted under, i.e. `/shop` (empty when not stripped)
+// Hint: build links via `router.BaseURL( req ) + "/cart"`
+func BaseURL( req *http.Request ) string {
+    base, _ := req.Context().Value( baseUrlContextId ).(string)
+    return base
+}
+
+// Provide a static file, i.e.:
+//     kern.Router.StaticFile( "/robots.txt", "text/plain; charset=utf-8", "./static/robots.txt" )
+// Hint: conditional and range requests are supported, set the `Cache-Control` via `Route.Cache`
+func (router *Router) StaticFile( path string, contentType string, filename string ) (route *Route) {
+    fsys, name := os.DirFS( filepath.Dir( filename ) ), filepath.Base( filename )
+    route = router.Get( path, func( res http.ResponseWriter, req *http.Request, next RouteNext ) {
+        serveFile( res, req, next, route, contentType, fsys, name )
+    })
+    return
+}
+// Static file after hierarchy lookup, kern automatically provides a favicon via this function:
+//     kern.Router.HierarchyFile( kern.Hierarchy, "/favicon.ico", "image/x-icon", "images/favicon.ico" )
+func (router *Router) HierarchyFile( h *hierarchy.Hierarchy, path string, contentType string, suffixes ...string ) (route *Route) {
+    route = router.Get( path, func( res http.ResponseWriter, req *http.Request, next RouteNext ) {
+        fsys, name, ok := h.Find( suffixes... )
+        if !ok {
+            next()
+            return
+        }
+        serveFile( res, req, next, route, contentType, fsys, name )
+    })
+    return
 }
 // `FileServer` wrapper for exposing the contents of `dir` under `path`
-func (router *Router) StaticDir( path string, dir string ) {
+func (router *Router) StaticDir( path string, dir string ) (route *Route) {
     fileServer := http.FileServer( http.Dir(dir) )
-    router.Get( path, func( res http.ResponseWriter, req *http.Request, next RouteNext ) {
-        http.StripPrefix( path, fileServer ).ServeHTTP( res, req )
+    route = router.Get( gopath.Join( path, "*filepath" ), func( res http.ResponseWriter, req *http.Request, next RouteNext ) {
+        fileReq := *req
+        url := *req.URL
+        url.Path = "/" + Param( req, "filepath" )
+        url.RawPath = ""
+        fileReq.URL = &url
+        res.Header().Set( "Cache-Control", route.cacheControl() )
+        fileServer.ServeHTTP( res, &fileReq )
     })
+    return
 }
-// Serve file after hierarchy lookup
-func (router *Router) HierarchyDir( h *hierarchy.Hierarchy, path string ) {
-    router.Get( path, func( res http.ResponseWriter, req *http.Request, next RouteNext ) {
-        suffixPath := strings.TrimPrefix( req.URL.Path, path )
+// Serve file after hierarchy lookup, `foo.css.gz` is preferred over `foo.css` when the client accepts gzip
+// Hint: files missing on disk are served from the embedded defaults, see `hierarchy.Find`
+func (router *Router) HierarchyDir( h *hierarchy.Hierarchy, path string ) (route *Route) {
+    route = router.Get( gopath.Join( path, "*filepath" ), func( res http.ResponseWriter, req *http.Request, next RouteNext ) {
+        suffixPath := Param( req, "filepath" )
         contentType := mime.TypeByExtension( gopath.Ext(suffixPath) )
 
-        filename, ok := h.Lookup( path, suffixPath )
+        fsys, name, ok := h.Find( path, suffixPath )
         if !ok {
             next()
             return
         }
 
-        serveFile( res, contentType, filename )
+        // precompressed files need a known type, sniffing would only reveal gzip
+        if contentType != "" {
+            if gzipName, ok := precompressed( res, req, fsys, name ); ok {
+                name = gzipName
+            }
+        }
+        serveFile( res, req, next, route, contentType, fsys, name )
     })
+    return
 }
 
 // Send `text` with the correct mimetype
-func (router *Router) StaticText( path string, text string ) {
-    router.Get( path, func( res http.ResponseWriter, req *http.Request, next RouteNext ) {
+func (router *Router) StaticText( path string, text string ) *Route {
+    return router.Get( path, func( res http.ResponseWriter, req *http.Request, next RouteNext ) {
         res.Header().Set("Content-Type", "text/plain; charset=utf-8")
         fmt.Fprintf( res, text )
     })
@@ -191,16 +451,9 @@ func (router *Router) StaticText( path string, text string ) {
 // Example:
 //     router.StaticHtml( '<html><body><h1>Oh noes!, something went terribly wrong</h1></body></html>' )
 // Hint: usefull for static error messages which need a bit of formatting, use `view.View` for all else.
-func (router *Router) StaticHtml( path string, html string ) {
-    router.Get( path, func( res http.ResponseWriter, req *http.Request, next RouteNext ) {
+func (router *Router) StaticHtml( path string, html string ) *Route {
+    return router.Get( path, func( res http.ResponseWriter, req *http.Request, next RouteNext ) {
         res.Header().Set("Content-Type", "text/html; charset=utf-8")
         fmt.Fprintf( res, html )
     })
 }
-
-// Helper functions
-func notFound( res http.ResponseWriter, text string ) {
-    res.WriteHeader(404)
-    res.Header().Set("Content-Type", "text/html; charset=utf-8")
-    fmt.Fprintf( res, `<html lang="en"><head><title>Not Found</title></head><body><h1>404 Not Found</h1><p>` + text + `</p></body>` )
-}
@@ -0,0 +1,167 @@
+package router
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "sync"
+    "testing"
+)
+
+// legacy mount, stripped mounts two levels deep and a fall-through back to the root router
+func concurrencyRouter() *Router {
+    root := New( "/" )
+
+    legacy := root.NewMounted( "/legacy" )
+    legacy.Get( "/users/:id", func( res http.ResponseWriter, req *http.Request, next RouteNext ) {
+        fmt.Fprintf( res, "legacy %s %s", Param( req, "id" ), req.URL.Path )
+    })
+
+    api := New( "/api" )
+    api.StripPrefix = true
+    root.Mount( api )
+    v1 := api.NewMounted( "/v1" )
+    v1.Get( "/items/:id", func( res http.ResponseWriter, req *http.Request, next RouteNext ) {
+        fmt.Fprintf( res, "get %s %s %s", Param( req, "id" ), req.URL.Path, BaseURL( req ) )
+    })
+    v1.Post( "/items/:id", func( res http.ResponseWriter, req *http.Request, next RouteNext ) {
+        fmt.Fprintf( res, "post %s", Param( req, "id" ) )
+    })
+    v1.Get( "/fallthrough/:name", func( res http.ResponseWriter, req *http.Request, next RouteNext ) {
+        next()
+    })
+
+    root.Get( "/api/v1/fallthrough/:name", func( res http.ResponseWriter, req *http.Request, next RouteNext ) {
+        fmt.Fprintf( res, "root %s %s", Param( req, "name" ), req.URL.Path )
+    })
+    return root
+}
+
+type routerCase struct {
+    method string
+    path string
+    status int
+    body string
+    allow string
+}
+
+var routerCases = []routerCase{
+    { http.MethodGet, "/legacy/users/7", http.StatusOK, "legacy 7 /legacy/users/7", "" },
+    { http.MethodGet, "/legacy/users/7/edit", http.StatusNotFound, "", "" },
+    { http.MethodGet, "/api/v1/items/42", http.StatusOK, "get 42 /items/42 /api/v1", "" },
+    { http.MethodPost, "/api/v1/items/43", http.StatusOK, "post 43", "" },
+    { http.MethodGet, "/api/v1/fallthrough/bob", http.StatusOK, "root bob /api/v1/fallthrough/bob", "" },
+    { http.MethodDelete, "/api/v1/items/44", http.StatusMethodNotAllowed, "", "GET, HEAD, OPTIONS, POST" },
+    { http.MethodOptions, "/api/v1/items/45", http.StatusNoContent, "", "GET, HEAD, OPTIONS, POST" },
+    { http.MethodGet, "/api/v2/items/46", http.StatusNotFound, "", "" },
+}
+
+func checkRouterCase( r *Router, c routerCase ) error {
+    res := httptest.NewRecorder()
+    r.ServeHTTP( res, httptest.NewRequest( c.method, c.path, nil ) )
+    body, _ := io.ReadAll( res.Body )
+    if res.Code != c.status {
+        return fmt.Errorf( "%s %s: status %d, expected %d", c.method, c.path, res.Code, c.status )
+    }
+    if c.body != "" && string( body ) != c.body {
+        return fmt.Errorf( "%s %s: body %q, expected %q", c.method, c.path, body, c.body )
+    }
+    if allow := res.Header().Get( "Allow" ); allow != c.allow {
+        return fmt.Errorf( "%s %s: Allow %q, expected %q", c.method, c.path, allow, c.allow )
+    }
+    return nil
+}
+
+func TestMountedRouters( t *testing.T ) {
+    r := concurrencyRouter()
+    for _, c := range routerCases {
+        if err := checkRouterCase( r, c ); err != nil {
+            t.Error( err )
+        }
+    }
+}
+
+// shared routers must not leak fall-through, params or allowed methods between requests, run with `-race`
+func TestMountedRoutersConcurrently( t *testing.T ) {
+    r := concurrencyRouter()
+    var wait sync.WaitGroup
+    errors := make(chan error, 16 * len( routerCases ))
+    for worker := 0; worker < 16; worker++ {
+        wait.Add( 1 )
+        go func( worker int ) {
+            defer wait.Done()
+            for i := 0; i < 50; i++ {
+                c := routerCases[ (worker + i) % len( routerCases ) ]
+                if err := checkRouterCase( r, c ); err != nil {
+                    errors <- err
+                    return
+                }
+            }
+        }( worker )
+    }
+    wait.Wait()
+    close( errors )
+    for err := range errors {
+        t.Error( err )
+    }
+}
+
+// wraps the writer to record the status, as i.e. `accesslog` does
+type recordingWriter struct {
+    http.ResponseWriter
+    status int
+}
+
+func (res *recordingWriter) WriteHeader( status int ) {
+    res.status = status
+    res.ResponseWriter.WriteHeader( status )
+}
+
+type testContextType int; const middlewareContextId = testContextType(1)
+
+// 404, 405 and automatic `OPTIONS` responses pass through the middlewares like any route
+func TestFallThroughUsesMiddleware( t *testing.T ) {
+    r := New( "/" )
+    var recorded *recordingWriter
+    r.Use( func( res http.ResponseWriter, req *http.Request, next MiddlewareNext ) {
+        recorded = &recordingWriter{ ResponseWriter: res }
+        next( recorded, req.WithContext( context.WithValue( req.Context(), middlewareContextId, "seen" ) ) )
+    })
+    r.NotFoundHandler = func( res http.ResponseWriter, req *http.Request, next RouteNext ) {
+        res.WriteHeader( http.StatusNotFound )
+        fmt.Fprint( res, req.Context().Value( middlewareContextId ) )
+    }
+    r.Get( "/x", func( res http.ResponseWriter, req *http.Request, next RouteNext ) {
+        res.Write( []byte( "x" ) )
+    })
+
+    for _, c := range []struct{ method, path string; status int; body string }{
+        { http.MethodGet, "/missing", http.StatusNotFound, "seen" },
+        { http.MethodDelete, "/x", http.StatusMethodNotAllowed, "" },
+        { http.MethodOptions, "/x", http.StatusNoContent, "" },
+    } {
+        res := httptest.NewRecorder()
+        r.ServeHTTP( res, httptest.NewRequest( c.method, c.path, nil ) )
+        if res.Code != c.status || recorded.status != c.status {
+            t.Errorf( "%s %s: status %d, middleware saw %d, expected %d", c.method, c.path, res.Code, recorded.status, c.status )
+        }
+        if c.body != "" && res.Body.String() != c.body {
+            t.Errorf( "%s %s: body %q, expected %q", c.method, c.path, res.Body.String(), c.body )
+        }
+    }
+}
+
+// `Err` has no request, it logs the id the `requestid` module echoed in the response
+func TestErrLogsRequestId( t *testing.T ) {
+    output := captureLog( t )
+    res := httptest.NewRecorder()
+    res.Header().Set( "X-Request-ID", "abc123" )
+    Err( res, errors.New( "broken" ) )
+    if res.Code != http.StatusInternalServerError || !strings.Contains( output.String(), "[abc123] broken" ) {
+        t.Fatalf( "status %d, log %q", res.Code, output.String() )
+    }
+}
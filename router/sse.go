@@ -0,0 +1,139 @@
+/*
+    Server-sent events - `text/event-stream` with event ids, `Last-Event-ID` resume, retry and heartbeats
+
+    (c)copyright 2021 by Gerald Wodni <gerald.wodni@gmail.com>
+*/
+package router
+
+import (
+    "errors"
+    "fmt"
+    "net/http"
+    "strings"
+    "sync"
+    "time"
+)
+
+// Interval of comment lines keeping idle streams open through proxies
+var SSEHeartbeat = 15 * time.Second
+
+// Single server-sent event, only `Data` is required
+type Event struct {
+    Id string          `json:"id,omitempty"`
+    // event type, dispatched to `addEventListener( type )` instead of `onmessage`
+    Event string       `json:"event,omitempty"`
+    Data string        `json:"data"`
+    // reconnection delay requested from the client
+    Retry time.Duration `json:"retry,omitempty"`
+}
+
+// Called for each client, the stream ends once the handler returns.
+// Hint: block until `req.Context().Done()` i.e. while forwarding events from a `redis.Broker`
+type SSEHandler func( stream *EventStream, req *http.Request )
+
+// Returned when sending to a stream after its handler returned
+var ErrStreamClosed = errors.New( "sse: stream closed" )
+
+// Open event stream, safe for concurrent use
+type EventStream struct {
+    // id of the last event received by a reconnecting client, empty on first connect
+    LastEventId string
+    res http.ResponseWriter
+    controller *http.ResponseController
+    mutex sync.Mutex
+    closed bool
+}
+
+// Stream server-sent events to GET requests on `path`
+func (router *Router) SSE( path string, handler SSEHandler ) (route *Route) {
+    route = router.Get( path, func( res http.ResponseWriter, req *http.Request, next RouteNext ) {
+        header := res.Header()
+        header.Set( "Content-Type", "text/event-stream" )
+        header.Set( "Cache-Control", "no-cache" )
+        // disable response buffering of nginx
+        header.Set( "X-Accel-Buffering", "no" )
+        res.WriteHeader( http.StatusOK )
+        if req.Method == http.MethodHead {
+            return
+        }
+
+        stream := &EventStream{
+            LastEventId: req.Header.Get( "Last-Event-ID" ),
+            res: res,
+            controller: http.NewResponseController( res ),
+        }
+        stream.flush()
+        done := make(chan struct{})
+        go stream.heartbeat( done )
+        defer func() {
+            close( done )
+            // no writes once the handler returned
+            stream.mutex.Lock()
+            stream.closed = true
+            stream.mutex.Unlock()
+        }()
+        handler( stream, req )
+    })
+    // streams only handle their full path
+    return route.Exact()
+}
+
+// Send `event` and flush it to the client
+func (stream *EventStream) Send( event Event ) error {
+    var message strings.Builder
+    if event.Id != "" {
+        fmt.Fprintf( &message, "id: %s\n", singleLine( event.Id ) )
+    }
+    if event.Event != "" {
+        fmt.Fprintf( &message, "event: %s\n", singleLine( event.Event ) )
+    }
+    if event.Retry > 0 {
+        fmt.Fprintf( &message, "retry: %d\n", event.Retry.Milliseconds() )
+    }
+    for _, line := range strings.Split( strings.ReplaceAll( event.Data, "\r\n", "\n" ), "\n" ) {
+        fmt.Fprintf( &message, "data: %s\n", line )
+    }
+    message.WriteString( "\n" )
+    return stream.write( message.String() )
+}
+
+// Send comment line, ignored by clients
+func (stream *EventStream) Comment( text string ) error {
+    return stream.write( ": " + singleLine( text ) + "\n\n" )
+}
+
+func (stream *EventStream) write( message string ) error {
+    stream.mutex.Lock()
+    defer stream.mutex.Unlock()
+    if stream.closed {
+        return ErrStreamClosed
+    }
+    if _, err := stream.res.Write( []byte( message ) ); err != nil {
+        return err
+    }
+    return stream.flush()
+}
+
+func (stream *EventStream) flush() error {
+    return stream.controller.Flush()
+}
+
+func (stream *EventStream) heartbeat( done chan struct{} ) {
+    ticker := time.NewTicker( SSEHeartbeat )
+    defer ticker.Stop()
+    for {
+        select {
+            case <-done:
+                return
+            case <-ticker.C:
+                if stream.Comment( "heartbeat" ) != nil {
+                    return
+                }
+        }
+    }
+}
+
+// ids and event types end at line breaks
+func singleLine( text string ) string {
+    return strings.NewReplacer( "\r", "", "\n", "" ).Replace( text )
+}
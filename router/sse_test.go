@@ -0,0 +1,95 @@
+package router
+
+import (
+    "bufio"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+)
+
+// events must pass `Compress` and the `StatusWriter` of `ServeHTTP` unbuffered
+func TestSSEThroughCompress( t *testing.T ) {
+    r := New( "/" )
+    r.Use( Compress )
+    r.SSE( "/events", func( stream *EventStream, req *http.Request ) {
+        stream.Send( Event{ Id: "1", Event: "greeting", Data: "hello\nworld" } )
+        <-req.Context().Done()
+    })
+    server := httptest.NewServer( r )
+    defer server.Close()
+
+    req, _ := http.NewRequest( http.MethodGet, server.URL + "/events", nil )
+    req.Header.Set( "Accept-Encoding", "gzip" )
+    client := &http.Client{ Timeout: 2 * time.Second }
+    res, err := client.Do( req )
+    if err != nil {
+        t.Fatal( err )
+    }
+    defer res.Body.Close()
+    if contentType := res.Header.Get( "Content-Type" ); contentType != "text/event-stream" {
+        t.Fatalf( "Content-Type %q", contentType )
+    }
+    if encoding := res.Header.Get( "Content-Encoding" ); encoding != "" {
+        t.Fatalf( "event stream compressed as %q", encoding )
+    }
+
+    reader := bufio.NewReader( res.Body )
+    lines := []string{}
+    for {
+        line, err := reader.ReadString( '\n' )
+        if err != nil {
+            t.Fatal( err )
+        }
+        if line == "\n" {
+            break
+        }
+        lines = append( lines, strings.TrimSuffix( line, "\n" ) )
+    }
+    expected := "id: 1|event: greeting|data: hello|data: world"
+    if got := strings.Join( lines, "|" ); got != expected {
+        t.Fatalf( "event %q, expected %q", got, expected )
+    }
+}
+
+func TestEventStreamFormat( t *testing.T ) {
+    r := New( "/" )
+    var lastEventId string
+    r.SSE( "/events", func( stream *EventStream, req *http.Request ) {
+        lastEventId = stream.LastEventId
+        stream.Send( Event{ Data: "plain" } )
+        stream.Send( Event{ Id: "7\n", Event: "update", Data: "a\r\nb\nc", Retry: 3 * time.Second } )
+        stream.Comment( "keep\nalive" )
+    })
+
+    req := httptest.NewRequest( http.MethodGet, "/events", nil )
+    req.Header.Set( "Last-Event-ID", "6" )
+    res := httptest.NewRecorder()
+    r.ServeHTTP( res, req )
+
+    expected := "data: plain\n\n" +
+        "id: 7\nevent: update\nretry: 3000\ndata: a\ndata: b\ndata: c\n\n" +
+        ": keepalive\n\n"
+    if body := res.Body.String(); body != expected {
+        t.Fatalf( "body %q, expected %q", body, expected )
+    }
+    if lastEventId != "6" {
+        t.Fatalf( "LastEventId %q", lastEventId )
+    }
+    if cacheControl := res.Header().Get( "Cache-Control" ); cacheControl != "no-cache" {
+        t.Fatalf( "Cache-Control %q", cacheControl )
+    }
+}
+
+func TestEventStreamClosed( t *testing.T ) {
+    r := New( "/" )
+    streams := make(chan *EventStream, 1)
+    r.SSE( "/events", func( stream *EventStream, req *http.Request ) {
+        streams <- stream
+    })
+    r.ServeHTTP( httptest.NewRecorder(), httptest.NewRequest( http.MethodGet, "/events", nil ) )
+    if err := ( <-streams ).Send( Event{ Data: "late" } ); err != ErrStreamClosed {
+        t.Fatalf( "send after handler returned: %v", err )
+    }
+}
@@ -0,0 +1,119 @@
+/*
+    Static files - conditional requests (`ETag`, `Last-Modified`), byte ranges and cache policies
+
+    (c)copyright 2021 by Gerald Wodni <gerald.wodni@gmail.com>
+*/
+package router
+
+import (
+    "bytes"
+    "crypto/sha256"
+    "fmt"
+    "io"
+    "io/fs"
+    "mime"
+    "net/http"
+    gopath "path"
+    "strings"
+    "time"
+)
+
+// Rendered as `Cache-Control` header of static files
+type CachePolicy struct {
+    // how long clients may use their copy without revalidating
+    MaxAge time.Duration
+    // forbid shared caches i.e. proxies to store the file
+    Private bool
+    // file never changes under its url, i.e. fingerprinted assets
+    Immutable bool
+}
+
+// Used when a route has no `Cache` policy: clients keep a copy but revalidate it via `ETag` on every use
+var DefaultCachePolicy = CachePolicy{}
+
+func (policy CachePolicy) String() string {
+    directives := []string{ "public" }
+    if policy.Private {
+        directives[0] = "private"
+    }
+    if policy.MaxAge <= 0 {
+        directives = append( directives, "no-cache" )
+    } else {
+        directives = append( directives, fmt.Sprintf( "max-age=%d", int( policy.MaxAge.Seconds() ) ) )
+    }
+    if policy.Immutable {
+        directives = append( directives, "immutable" )
+    }
+    return strings.Join( directives, ", " )
+}
+
+// Set cache policy for files served by this route, i.e. `router.HierarchyDir( h, "/images" ).Cache( router.CachePolicy{ MaxAge: time.Hour } )`
+func (route *Route) Cache( policy CachePolicy ) *Route {
+    route.cachePolicy = &policy
+    return route
+}
+
+func (route *Route) cacheControl() string {
+    if route.cachePolicy == nil {
+        return DefaultCachePolicy.String()
+    }
+    return route.cachePolicy.String()
+}
+
+// serve `name` of `fsys` honouring `If-None-Match`, `If-Modified-Since` and `Range`, an empty `contentType` is detected.
+// Directories are left to the following routes
+func serveFile( res http.ResponseWriter, req *http.Request, next RouteNext, route *Route, contentType string, fsys fs.FS, name string ) {
+    file, err := fsys.Open( name )
+    if err != nil {
+        Error( res, req, http.StatusInternalServerError, err )
+        return
+    }
+    defer file.Close()
+
+    info, err := file.Stat()
+    if err != nil {
+        Error( res, req, http.StatusInternalServerError, err )
+        return
+    }
+    if info.IsDir() {
+        next()
+        return
+    }
+
+    etag := fmt.Sprintf( `"%x-%x"`, info.ModTime().UnixNano(), info.Size() )
+    content, seekable := file.(io.ReadSeeker)
+    // embedded files have no modification time, identify them by content
+    if !seekable || info.ModTime().IsZero() {
+        data, err := io.ReadAll( file )
+        if err != nil {
+            Error( res, req, http.StatusInternalServerError, err )
+            return
+        }
+        content = bytes.NewReader( data )
+        sum := sha256.Sum256( data )
+        etag = fmt.Sprintf( `"%x"`, sum[:16] )
+    }
+
+    // detected like `http.ServeContent` does, but before it answers 304 without any `Content-Type`
+    if contentType == "" {
+        contentType = mime.TypeByExtension( gopath.Ext( name ) )
+    }
+    if contentType == "" {
+        sniff := make([]byte, 512)
+        n, _ := io.ReadFull( content, sniff )
+        contentType = http.DetectContentType( sniff[:n] )
+        if _, err := content.Seek( 0, io.SeekStart ); err != nil {
+            Error( res, req, http.StatusInternalServerError, err )
+            return
+        }
+    }
+    // revalidations are answered with the same validator as the compressed response
+    if compressor, ok := compressorOf( res ); ok && compressor.compresses( res.Header(), contentType ) {
+        etag = "W/" + etag
+    }
+
+    res.Header().Set( "Content-Type", contentType )
+    res.Header().Set( "ETag", etag )
+    res.Header().Set( "Cache-Control", route.cacheControl() )
+    http.ServeContent( res, req, info.Name(), info.ModTime(), content )
+}
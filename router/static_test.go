@@ -0,0 +1,63 @@
+package router
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+
+    "github.com/GeraldWodni/kern.go/hierarchy"
+)
+
+func staticRouter( t *testing.T ) *Router {
+    prefix := t.TempDir()
+    if err := os.MkdirAll( filepath.Join( prefix, "css", "theme" ), 0755 ); err != nil {
+        t.Fatal( err )
+    }
+    if err := os.WriteFile( filepath.Join( prefix, "css", "site.css" ), []byte( strings.Repeat( "body { margin: 0 }\n", 50 ) ), 0644 ); err != nil {
+        t.Fatal( err )
+    }
+    r := New( "/" )
+    r.Use( Compress )
+    r.HierarchyDir( &hierarchy.Hierarchy{ Prefixes: []string{ prefix } }, "/css" )
+    r.Get( "/css/*rest", func( res http.ResponseWriter, req *http.Request, next RouteNext ) {
+        res.Write( []byte( "listing " + Param( req, "rest" ) ) )
+    })
+    return r
+}
+
+// directories are not files, the following routes handle them
+func TestStaticDirectoryFallsThrough( t *testing.T ) {
+    r := staticRouter( t )
+    for _, path := range []string{ "/css", "/css/theme" } {
+        res := httptest.NewRecorder()
+        r.ServeHTTP( res, httptest.NewRequest( http.MethodGet, path, nil ) )
+        if expected := "listing " + strings.TrimPrefix( strings.TrimPrefix( path, "/css" ), "/" ); res.Code != http.StatusOK || res.Body.String() != expected {
+            t.Errorf( "%s: status %d, body %q, expected %q", path, res.Code, res.Body.String(), expected )
+        }
+    }
+}
+
+// revalidating a compressed file yields the validator sent with it
+func TestStaticNotModifiedETag( t *testing.T ) {
+    r := staticRouter( t )
+    for _, encoding := range []string{ "gzip", "" } {
+        req := httptest.NewRequest( http.MethodGet, "/css/site.css", nil )
+        req.Header.Set( "Accept-Encoding", encoding )
+        res := httptest.NewRecorder()
+        r.ServeHTTP( res, req )
+        etag := res.Header().Get( "ETag" )
+        if res.Code != http.StatusOK || etag == "" || strings.HasPrefix( etag, "W/" ) != ( encoding != "" ) {
+            t.Fatalf( "%q: status %d, ETag %q", encoding, res.Code, etag )
+        }
+
+        req.Header.Set( "If-None-Match", etag )
+        res = httptest.NewRecorder()
+        r.ServeHTTP( res, req )
+        if res.Code != http.StatusNotModified || res.Header().Get( "ETag" ) != etag {
+            t.Errorf( "%q: status %d, ETag %q, expected %q", encoding, res.Code, res.Header().Get( "ETag" ), etag )
+        }
+    }
+}
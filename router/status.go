@@ -0,0 +1,84 @@
+/*
+    Status capture - response writer wrapper recording status and size, i.e. for access logs
+
+    (c)copyright 2021 by Gerald Wodni <gerald.wodni@gmail.com>
+*/
+package router
+
+import (
+    "bufio"
+    "net"
+    "net/http"
+)
+
+// Records status and bytes written, every response served by a `Router` is wrapped in one, see `StatusOf`
+type StatusWriter struct {
+    http.ResponseWriter
+    // 0 until a header is written
+    Status int
+    // body bytes written
+    Bytes int64
+}
+
+// Wrap `res` to capture its status and size
+func NewStatusWriter( res http.ResponseWriter ) *StatusWriter {
+    return &StatusWriter{ ResponseWriter: res }
+}
+
+func (res *StatusWriter) WriteHeader( status int ) {
+    // informational headers like `103 Early Hints` may precede the final status
+    if res.Status == 0 && status >= 200 {
+        res.Status = status
+    }
+    res.ResponseWriter.WriteHeader( status )
+}
+
+func (res *StatusWriter) Write( b []byte ) (int, error) {
+    if res.Status == 0 {
+        res.Status = http.StatusOK
+    }
+    size, err := res.ResponseWriter.Write( b )
+    res.Bytes += int64( size )
+    return size, err
+}
+
+func (res *StatusWriter) Flush() {
+    res.FlushError()
+}
+
+// flush wrapped writers, i.e. for `SSE` behind `Compress`
+func (res *StatusWriter) FlushError() error {
+    // flushing commits an implicit `200 OK`
+    if res.Status == 0 {
+        res.Status = http.StatusOK
+    }
+    return http.NewResponseController( res.ResponseWriter ).Flush()
+}
+
+// records `101 Switching Protocols`, i.e. for `WebSocket`
+func (res *StatusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+    conn, buffer, err := http.NewResponseController( res.ResponseWriter ).Hijack()
+    if err == nil {
+        res.Status = http.StatusSwitchingProtocols
+    }
+    return conn, buffer, err
+}
+
+func (res *StatusWriter) Unwrap() http.ResponseWriter {
+    return res.ResponseWriter
+}
+
+// get `StatusWriter` wrapped by `res`, i.e. in `module.Request.EndRequest`
+func StatusOf( res http.ResponseWriter ) (statusWriter *StatusWriter, ok bool) {
+    for res != nil {
+        if statusWriter, ok = res.(*StatusWriter); ok {
+            return
+        }
+        unwrapper, canUnwrap := res.(interface{ Unwrap() http.ResponseWriter })
+        if !canUnwrap {
+            break
+        }
+        res = unwrapper.Unwrap()
+    }
+    return nil, false
+}
@@ -0,0 +1,157 @@
+/*
+    Timeouts - per route deadlines which cancel `req.Context()` and answer overrunning handlers with an error page
+
+    (c)copyright 2021 by Gerald Wodni <gerald.wodni@gmail.com>
+*/
+package router
+
+import (
+    "bytes"
+    "context"
+    "fmt"
+    "net/http"
+    "runtime/debug"
+    "sync"
+    "time"
+
+    "github.com/GeraldWodni/kern.go/log"
+)
+
+// Status of the error page rendered for overrunning handlers, use `http.StatusGatewayTimeout` when waiting on backends
+var TimeoutStatus = http.StatusServiceUnavailable
+
+// Cancel `req.Context()` of the handler after `timeout`, i.e. `router.Get( "/status", handler ).Timeout( 5*time.Second )`.
+// Hint: responses are buffered until the handler returns, so do not use timeouts for `SSE` or `WebSocket` routes.
+// Handlers keep running after the deadline until they honour the context, i.e. via `redis.Do( req, ... )`;
+// request modules like `session` are ended once they return
+func (route *Route) Timeout( timeout time.Duration ) *Route {
+    route.timeout = timeout
+    return route
+}
+
+// run route handler, guarded by its timeout if set
+func (route *Route) serve( res http.ResponseWriter, req *http.Request, next RouteNext ) {
+    if route.timeout <= 0 {
+        route.Handler( res, req, next )
+        return
+    }
+
+    ctx, cancel := context.WithTimeout( req.Context(), route.timeout )
+    defer cancel()
+    req = req.WithContext( ctx )
+    buffer := &timeoutWriter{ header: make(http.Header) }
+    done := make(chan struct{})
+    resume := false
+    var panicked interface{}
+    go func() {
+        defer func() {
+            if recovered := recover(); recovered != nil {
+                panicked = recovered
+                // keep stack of the handler's goroutine
+                if recovered != http.ErrAbortHandler {
+                    panicked = &PanicError{ Value: recovered, Stack: debug.Stack() }
+                }
+            }
+            // nobody is left to re-panic after the timeout page was sent
+            if !buffer.finish() {
+                if panicErr, ok := panicked.(*PanicError); ok {
+                    log.Of( req ).Error( "Route", route.Method, route.Path, "panicked after timeout", panicErr, "\n" + string( panicErr.Stack ) )
+                }
+            }
+            close( done )
+        }()
+        route.Handler( buffer, req, func() {
+            resume = true
+        })
+    }()
+
+    select {
+        case <-done:
+        case <-ctx.Done():
+            if buffer.timeout() {
+                // the handler keeps using `req`, its modules are ended once it returns
+                if state, ok := stateOf( req ); ok {
+                    state.overrunning = append( state.overrunning, done )
+                }
+                // a canceled parent context means the client is gone
+                if ctx.Err() == context.DeadlineExceeded {
+                    Error( res, req, TimeoutStatus, fmt.Errorf( "Route %s %s exceeded timeout of %s", route.Method, route.Path, route.timeout ) )
+                }
+                return
+            }
+            // handler returned just in time, keep its response
+            <-done
+    }
+    if panicked != nil {
+        panic( panicked )
+    }
+    buffer.copyTo( res )
+    if resume {
+        next()
+    }
+}
+
+// collects the response of a handler until it returns in time
+type timeoutWriter struct {
+    header http.Header
+    body bytes.Buffer
+    status int
+    mutex sync.Mutex
+    timedOut bool
+    finished bool
+}
+
+func (res *timeoutWriter) Header() http.Header {
+    return res.header
+}
+
+func (res *timeoutWriter) WriteHeader( status int ) {
+    res.mutex.Lock()
+    defer res.mutex.Unlock()
+    if res.status == 0 {
+        res.status = status
+    }
+}
+
+func (res *timeoutWriter) Write( b []byte ) (int, error) {
+    res.mutex.Lock()
+    defer res.mutex.Unlock()
+    if res.timedOut {
+        return 0, http.ErrHandlerTimeout
+    }
+    if res.status == 0 {
+        res.status = http.StatusOK
+    }
+    return res.body.Write( b )
+}
+
+// reject further writes, false if the handler returned first
+func (res *timeoutWriter) timeout() bool {
+    res.mutex.Lock()
+    defer res.mutex.Unlock()
+    if res.finished {
+        return false
+    }
+    res.timedOut = true
+    return true
+}
+
+// mark the handler as returned, false if the timeout page was sent instead
+func (res *timeoutWriter) finish() bool {
+    res.mutex.Lock()
+    defer res.mutex.Unlock()
+    res.finished = true
+    return !res.timedOut
+}
+
+// pass buffered response on, nothing is written if the handler did not respond
+func (res *timeoutWriter) copyTo( target http.ResponseWriter ) {
+    for name, values := range res.header {
+        target.Header()[ name ] = values
+    }
+    if res.status == 0 {
+        return
+    }
+    target.WriteHeader( res.status )
+    target.Write( res.body.Bytes() )
+}
@@ -0,0 +1,87 @@
+package router
+
+import (
+    "bytes"
+    stdlog "log"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+)
+
+// log output, written by handler goroutines while the test reads it
+type logBuffer struct {
+    buffer bytes.Buffer
+    mutex sync.Mutex
+}
+
+func (b *logBuffer) Write( p []byte ) (int, error) {
+    b.mutex.Lock()
+    defer b.mutex.Unlock()
+    return b.buffer.Write( p )
+}
+
+func (b *logBuffer) String() string {
+    b.mutex.Lock()
+    defer b.mutex.Unlock()
+    return b.buffer.String()
+}
+
+func captureLog( t *testing.T ) *logBuffer {
+    buffer := &logBuffer{}
+    previous := stdlog.Writer()
+    stdlog.SetOutput( buffer )
+    t.Cleanup( func() { stdlog.SetOutput( previous ) } )
+    return buffer
+}
+
+func TestTimeout( t *testing.T ) {
+    r := New( "/" )
+    r.Get( "/fast", func( res http.ResponseWriter, req *http.Request, next RouteNext ) {
+        res.Write( []byte( "fast" ) )
+    }).Timeout( time.Second )
+    r.Get( "/slow", func( res http.ResponseWriter, req *http.Request, next RouteNext ) {
+        <-req.Context().Done()
+        // a handler returning right at the deadline may still answer
+        time.Sleep( 20 * time.Millisecond )
+        if _, err := res.Write( []byte( "late" ) ); err != http.ErrHandlerTimeout {
+            t.Errorf( "late write: %v", err )
+        }
+    }).Timeout( 10 * time.Millisecond )
+
+    res := httptest.NewRecorder()
+    r.ServeHTTP( res, httptest.NewRequest( http.MethodGet, "/fast", nil ) )
+    if res.Code != http.StatusOK || res.Body.String() != "fast" {
+        t.Fatalf( "fast: status %d, body %q", res.Code, res.Body.String() )
+    }
+    res = httptest.NewRecorder()
+    r.ServeHTTP( res, httptest.NewRequest( http.MethodGet, "/slow", nil ) )
+    if res.Code != TimeoutStatus || strings.Contains( res.Body.String(), "late" ) {
+        t.Fatalf( "slow: status %d, body %q", res.Code, res.Body.String() )
+    }
+}
+
+// panics after the timeout page was sent cannot reach `serveRecover` and must be logged
+func TestTimeoutLatePanic( t *testing.T ) {
+    logged := captureLog( t )
+    r := New( "/" )
+    r.Get( "/late", func( res http.ResponseWriter, req *http.Request, next RouteNext ) {
+        <-req.Context().Done()
+        time.Sleep( 10 * time.Millisecond )
+        panic( "late boom" )
+    }).Timeout( 10 * time.Millisecond )
+
+    res := httptest.NewRecorder()
+    r.ServeHTTP( res, httptest.NewRequest( http.MethodGet, "/late", nil ) )
+    if res.Code != TimeoutStatus {
+        t.Fatalf( "status %d", res.Code )
+    }
+    for deadline := time.Now().Add( 2 * time.Second ); time.Now().Before( deadline ); time.Sleep( 10 * time.Millisecond ) {
+        if output := logged.String(); strings.Contains( output, "panicked after timeout" ) && strings.Contains( output, "late boom" ) {
+            return
+        }
+    }
+    t.Fatalf( "late panic not logged: %q", logged.String() )
+}
@@ -0,0 +1,94 @@
+/*
+    Route tree - routes are compiled into a prefix tree of path segments for O(path-length) lookup.
+    Matches are returned in registration order to keep the `next()` fall-through semantics.
+
+    (c)copyright 2021 by Gerald Wodni <gerald.wodni@gmail.com>
+*/
+package router
+
+import (
+    "sort"
+    "strings"
+)
+
+type node struct {
+    children map[string]*node
+    param *node
+    // indices of routes whose pattern ends here, they match this node and everything below it
+    routes []int
+    // indices of routes whose pattern ends here, they only match this node
+    exact []int
+}
+
+func buildTree( routes []*Route ) (root *node) {
+    root = &node{}
+    for i := range routes {
+        n := root
+        for _, seg := range routes[i].compiled() {
+            if seg.Type == wildcardSegment {
+                // a wildcard matches everything below, just like the prefix itself
+                break
+            }
+            n = n.child( seg )
+        }
+        if routes[i].matchesExactly() {
+            n.exact = append( n.exact, i )
+        } else {
+            n.routes = append( n.routes, i )
+        }
+    }
+    return
+}
+
+func (n *node) child( seg segment ) (child *node) {
+    if seg.Type == paramSegment {
+        if n.param == nil {
+            n.param = &node{}
+        }
+        return n.param
+    }
+    if n.children == nil {
+        n.children = make(map[string]*node)
+    }
+    child, ok := n.children[ seg.Name ]
+    if !ok {
+        child = &node{}
+        n.children[ seg.Name ] = child
+    }
+    return
+}
+
+// collect indices of all routes matching `parts`, sorted by registration
+func (n *node) lookup( parts []string ) (matches []int) {
+    matches = n.collect( parts, 0, []int{} )
+    sort.Ints( matches )
+    return
+}
+
+func (n *node) collect( parts []string, depth int, matches []int ) []int {
+    matches = append( matches, n.routes... )
+    if depth == len( parts ) {
+        return append( matches, n.exact... )
+    }
+    if child, ok := n.children[ parts[depth] ]; ok {
+        matches = child.collect( parts, depth+1, matches )
+    }
+    if n.param != nil {
+        matches = n.param.collect( parts, depth+1, matches )
+    }
+    return matches
+}
+
+// extract parameter values of an already matched pattern
+func extractParams( segments []segment, parts []string ) (params Params) {
+    for i, seg := range segments {
+        switch seg.Type {
+            case paramSegment:
+                params = setParam( params, seg.Name, parts[i] )
+            case wildcardSegment:
+                params = setParam( params, seg.Name, strings.Join( parts[i:], "/" ) )
+                return
+        }
+    }
+    return
+}
@@ -0,0 +1,184 @@
+package router
+
+import (
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+)
+
+// previous route matching: every pattern is compared against the path in registration order
+func matchLinear( segments []segment, parts []string ) (params Params, ok bool) {
+    for i, seg := range segments {
+        if seg.Type == wildcardSegment {
+            return setParam( params, seg.Name, strings.Join( parts[i:], "/" ) ), true
+        }
+        if i >= len( parts ) {
+            return nil, false
+        }
+        switch seg.Type {
+            case staticSegment:
+                if parts[i] != seg.Name {
+                    return nil, false
+                }
+            case paramSegment:
+                params = setParam( params, seg.Name, parts[i] )
+        }
+    }
+    return params, true
+}
+
+// first GET route handling `parts`, descending into mounted routers like `serveRoutes`
+func resolveLinear( router *Router, parts []string ) (route *Route, params Params) {
+    for _, candidate := range router.Routes {
+        if !candidate.acceptsMethod( http.MethodGet ) {
+            continue
+        }
+        matchParams, ok := matchLinear( candidate.compiled(), parts )
+        if !ok || ( candidate.matchesExactly() && !candidate.matchesFully( parts ) ) {
+            continue
+        }
+        if candidate.mounted != nil {
+            if route, params = resolveLinear( candidate.mounted, parts ); route != nil {
+                return
+            }
+            continue
+        }
+        return candidate, matchParams
+    }
+    return nil, nil
+}
+func resolveTree( router *Router, parts []string ) (route *Route, params Params) {
+    tree, routes := router.compile()
+    for _, index := range tree.lookup( parts ) {
+        candidate := routes[ index ]
+        if !candidate.acceptsMethod( http.MethodGet ) {
+            continue
+        }
+        if candidate.mounted != nil {
+            if route, params = resolveTree( candidate.mounted, parts ); route != nil {
+                return
+            }
+            continue
+        }
+        return candidate, extractParams( candidate.compiled(), parts )
+    }
+    return nil, nil
+}
+
+func noopHandler( res http.ResponseWriter, req *http.Request, next RouteNext ) {}
+
+// 10 sections with 4 mounted areas each, 12 routes per area: 480 routes plus 50 mount routes
+func benchmarkRouter() *Router {
+    root := New( "/" )
+    for s := 0; s < 10; s++ {
+        section := root.NewMounted( fmt.Sprintf( "/section%d", s ) )
+        for a := 0; a < 4; a++ {
+            area := section.NewMounted( fmt.Sprintf( "/area%d", a ) )
+            for i := 0; i < 4; i++ {
+                area.Get( fmt.Sprintf( "/page%d", i ), noopHandler )
+                area.Post( fmt.Sprintf( "/page%d", i ), noopHandler )
+            }
+            area.Get( "/items/:id", noopHandler )
+            area.Get( "/items/:id/edit", noopHandler )
+            area.Put( "/items/:id", noopHandler )
+            area.Get( "/files/*filepath", noopHandler )
+        }
+    }
+    return root
+}
+
+// hits spread over the tree, the last section is the worst case for a linear scan
+var benchmarkPaths = []string{
+    "/section0/area0/page0",
+    "/section4/area2/items/42",
+    "/section9/area3/items/42/edit",
+    "/section9/area3/files/css/index.css",
+    "/section9/area3/missing",
+}
+
+func TestTreeMatchesLinearScan( t *testing.T ) {
+    for root, paths := range map[*Router][]string{ benchmarkRouter(): benchmarkPaths, flatBenchmarkRouter(): flatBenchmarkPaths } {
+        for _, path := range paths {
+            parts := splitPath( path )
+            treeRoute, treeParams := resolveTree( root, parts )
+            linearRoute, linearParams := resolveLinear( root, parts )
+            if treeRoute != linearRoute || fmt.Sprint( treeParams ) != fmt.Sprint( linearParams ) {
+                t.Fatalf( "%s: tree %v %v, linear %v %v", path, treeRoute, treeParams, linearRoute, linearParams )
+            }
+        }
+    }
+}
+
+func TestInvalidPatternsPanic( t *testing.T ) {
+    for _, path := range []string{ "/files/*rest/more", "/user/:", "/user/:/edit", "/files/*" } {
+        func() {
+            defer func() {
+                if recover() == nil {
+                    t.Errorf( "%s: registered without panic", path )
+                }
+            }()
+            New( "/" ).Get( path, noopHandler )
+        }()
+    }
+}
+
+// 500 routes on a single router
+func flatBenchmarkRouter() *Router {
+    root := New( "/" )
+    for i := 0; i < 125; i++ {
+        root.Get( fmt.Sprintf( "/resource%d", i ), noopHandler )
+        root.Get( fmt.Sprintf( "/resource%d/:id", i ), noopHandler )
+        root.Put( fmt.Sprintf( "/resource%d/:id", i ), noopHandler )
+        root.Get( fmt.Sprintf( "/resource%d/:id/edit", i ), noopHandler )
+    }
+    return root
+}
+
+var flatBenchmarkPaths = []string{
+    "/resource0",
+    "/resource60/42",
+    "/resource124/42/edit",
+    "/missing",
+}
+
+func benchmarkResolve( b *testing.B, root *Router, paths []string, resolve func( *Router, []string ) (*Route, Params) ) {
+    resolveTree( root, nil ) // compile outside the timer
+    parts := make([][]string, len( paths ))
+    for i, path := range paths {
+        parts[i] = splitPath( path )
+    }
+    b.ReportAllocs()
+    b.ResetTimer()
+    for n := 0; n < b.N; n++ {
+        resolve( root, parts[ n % len( parts ) ] )
+    }
+}
+
+func BenchmarkTreeLookupMounted( b *testing.B ) {
+    benchmarkResolve( b, benchmarkRouter(), benchmarkPaths, resolveTree )
+}
+func BenchmarkLinearScanMounted( b *testing.B ) {
+    benchmarkResolve( b, benchmarkRouter(), benchmarkPaths, resolveLinear )
+}
+func BenchmarkTreeLookupFlat( b *testing.B ) {
+    benchmarkResolve( b, flatBenchmarkRouter(), flatBenchmarkPaths, resolveTree )
+}
+func BenchmarkLinearScanFlat( b *testing.B ) {
+    benchmarkResolve( b, flatBenchmarkRouter(), flatBenchmarkPaths, resolveLinear )
+}
+
+// whole request through nested routers, including middleware and request state
+func BenchmarkServeHTTP( b *testing.B ) {
+    root := benchmarkRouter()
+    requests := make([]*http.Request, len( benchmarkPaths ))
+    for i, path := range benchmarkPaths {
+        requests[i] = httptest.NewRequest( http.MethodGet, path, nil )
+    }
+    b.ReportAllocs()
+    b.ResetTimer()
+    for n := 0; n < b.N; n++ {
+        root.ServeHTTP( httptest.NewRecorder(), requests[ n % len( requests ) ] )
+    }
+}
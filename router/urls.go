@@ -0,0 +1,110 @@
+/*
+    Named routes - reverse URL generation which respects the mount points of nested routers
+
+    (c)copyright 2021 by Gerald Wodni <gerald.wodni@gmail.com>
+*/
+package router
+
+import (
+    "fmt"
+    "net/http"
+    "net/url"
+    gopath "path"
+    "strings"
+    "sync/atomic"
+
+    "github.com/GeraldWodni/kern.go/log"
+)
+
+// changed whenever routes, mounts or names change, invalidates the names of all routers
+var namesGeneration atomic.Int64
+
+// Name route for `URLFor`, i.e. `router.Get( "/item/:id", handler ).Name( "item" )`
+// Hint: names are scoped to the router tree they are mounted in, websites may reuse names for different paths
+func (route *Route) Name( name string ) *Route {
+    route.name = name
+    namesGeneration.Add( 1 )
+    return route
+}
+
+// get route named `name` on `router` or any router mounted below it, the first one registered wins
+func (router *Router) namedRoute( name string ) (route *Route, ok bool) {
+    router.namesMutex.Lock()
+    defer router.namesMutex.Unlock()
+    if generation := namesGeneration.Load(); router.names == nil || router.namesBuilt != generation {
+        router.names = make(map[string]*Route)
+        router.collectNames( router.names )
+        router.namesBuilt = generation
+    }
+    route, ok = router.names[ name ]
+    return
+}
+
+func (router *Router) collectNames( names map[string]*Route ) {
+    _, routes := router.compile()
+    for _, route := range routes {
+        if route.name != "" {
+            if existing, exists := names[ route.name ]; !exists {
+                names[ route.name ] = route
+            } else if existing.FullPath() != route.FullPath() {
+                log.Warningf( "Router: route name '%s' is used for %s and %s, using the first", route.name, existing.FullPath(), route.FullPath() )
+            }
+        }
+        if route.mounted != nil {
+            route.mounted.collectNames( names )
+        }
+    }
+}
+
+// Absolute path of route with its pattern, including the mount points of all enclosing routers
+func (route *Route) FullPath() (path string) {
+    path = route.Path
+    for router := route.router; router != nil && router.parent != nil; router = router.parent {
+        // routes of routers without `StripPrefix` already contain their mount point
+        if router.StripPrefix {
+            path = gopath.Join( router.parentMountPoint, path )
+        }
+    }
+    return
+}
+
+// Build URL for route named `name` in the router tree serving `req`, i.e. the website's router
+// i.e. `router.URLFor( req, "item", router.Params{ "id": "42" } )` yields `/shop/item/42` when mounted under `/shop`
+func URLFor( req *http.Request, name string, params Params ) (path string, err error) {
+    state, ok := stateOf( req )
+    if !ok || state.router == nil {
+        err = fmt.Errorf( "router.URLFor: request for '%s' is not served by a router", name )
+        return
+    }
+    return state.router.URLFor( name, params )
+}
+
+// Build URL for route named `name` on `router` or any router mounted below it, parameters are filled from `params`
+func (router *Router) URLFor( name string, params Params ) (path string, err error) {
+    route, ok := router.namedRoute( name )
+    if !ok {
+        err = fmt.Errorf( "router.URLFor: no route named '%s'", name )
+        return
+    }
+
+    parts := []string{}
+    for _, seg := range compilePattern( route.FullPath() ) {
+        switch seg.Type {
+            case staticSegment:
+                parts = append( parts, seg.Name )
+            case paramSegment:
+                value, ok := params[ seg.Name ]
+                if !ok {
+                    err = fmt.Errorf( "router.URLFor: route '%s' requires parameter '%s'", name, seg.Name )
+                    return
+                }
+                parts = append( parts, url.PathEscape( value ) )
+            case wildcardSegment:
+                for _, part := range splitPath( params[ seg.Name ] ) {
+                    parts = append( parts, url.PathEscape( part ) )
+                }
+        }
+    }
+    path = "/" + strings.Join( parts, "/" )
+    return
+}
@@ -0,0 +1,45 @@
+package router
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "testing"
+)
+
+// two websites using the same route name, each resolves its own
+func TestURLForScopedPerRouter( t *testing.T ) {
+    resolve := func( res http.ResponseWriter, req *http.Request, next RouteNext ) {
+        path, err := URLFor( req, "item", Params{ "id": "42" } )
+        if err != nil {
+            path = err.Error()
+        }
+        res.Write( []byte( path ) )
+    }
+
+    shop := New( "/" )
+    shopItems := New( "/shop" )
+    shopItems.StripPrefix = true
+    shop.Mount( shopItems )
+    shopItems.Get( "/item/:id", resolve ).Name( "item" )
+
+    blog := New( "/" )
+    blog.Get( "/posts/:id", resolve ).Name( "item" )
+
+    for _, c := range []struct{ router *Router; path, expected string }{
+        { shop, "/shop/item/1", "/shop/item/42" },
+        { blog, "/posts/1", "/posts/42" },
+    } {
+        res := httptest.NewRecorder()
+        c.router.ServeHTTP( res, httptest.NewRequest( http.MethodGet, c.path, nil ) )
+        if body := res.Body.String(); body != c.expected {
+            t.Errorf( "%s: %q, expected %q", c.path, body, c.expected )
+        }
+    }
+
+    if _, err := shop.URLFor( "missing", nil ); err == nil {
+        t.Error( "unknown name resolved" )
+    }
+    if _, err := URLFor( httptest.NewRequest( http.MethodGet, "/", nil ), "item", nil ); err == nil {
+        t.Error( "request without router resolved" )
+    }
+}
@@ -0,0 +1,447 @@
+/*
+    WebSocket - connection upgrade and RFC 6455 framing (text, binary, fragmentation, ping/pong and close)
+
+    (c)copyright 2021 by Gerald Wodni <gerald.wodni@gmail.com>
+*/
+package router
+
+import (
+    "bufio"
+    "crypto/rand"
+    "crypto/sha1"
+    "crypto/tls"
+    "encoding/base64"
+    "encoding/binary"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "net"
+    "net/http"
+    "net/url"
+    "strings"
+    "sync"
+    "time"
+    "unicode/utf8"
+)
+
+// Message types, i.e. `conn.WriteMessage( router.TextMessage, data )`
+const (
+    continuationFrame = 0
+    TextMessage = 1
+    BinaryMessage = 2
+    CloseMessage = 8
+    PingMessage = 9
+    PongMessage = 10
+)
+
+// Close codes as defined by RFC 6455
+const (
+    CloseNormal = 1000
+    CloseGoingAway = 1001
+    CloseProtocolError = 1002
+    CloseUnsupportedData = 1003
+    CloseNoStatus = 1005
+    CloseInvalidPayload = 1007
+    CloseMessageTooBig = 1009
+    CloseInternalError = 1011
+)
+
+const webSocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// Maximum size of received messages, larger ones close the connection with `CloseMessageTooBig`
+var MaxWebSocketMessage = 1 << 20
+
+// Decides if an upgrade request is accepted, by default the `Origin` sent by browsers must match the requested host
+var WebSocketCheckOrigin = func( req *http.Request ) bool {
+    origin := req.Header.Get( "Origin" )
+    if origin == "" {
+        return true
+    }
+    originUrl, err := url.Parse( origin )
+    return err == nil && strings.EqualFold( originUrl.Host, req.Host )
+}
+
+// Called with the upgraded connection, it is closed once the handler returns.
+// `req` is the upgrade request, its context still holds modules like `session.Of` and `redis.Of`
+type WebSocketHandler func( conn *WebSocketConn, req *http.Request )
+
+// Sent or received close frame, returned by `ReadMessage` once the connection is closed
+type WebSocketCloseError struct {
+    Code int
+    Reason string
+}
+
+func (err *WebSocketCloseError) Error() string {
+    return fmt.Sprintf( "websocket closed: %d %s", err.Code, err.Reason )
+}
+
+// Returned when writing to a connection after its close frame was sent
+var ErrWebSocketClosed = errors.New( "websocket: connection closed" )
+
+// Upgraded connection, one goroutine may read while others write
+type WebSocketConn struct {
+    conn net.Conn
+    reader *bufio.Reader
+    // clients mask their frames, servers must not
+    client bool
+    writeMutex sync.Mutex
+    closeSent bool
+}
+
+// Upgrade requests on `path` to WebSocket connections served by `handler`, other requests are answered with `426 Upgrade Required`
+// Hint: the connection is hijacked, use `httptest.NewServer` and `DialWebSocket` for in-process tests
+func (router *Router) WebSocket( path string, handler WebSocketHandler ) (route *Route) {
+    route = router.Get( path, func( res http.ResponseWriter, req *http.Request, next RouteNext ) {
+        conn, err := upgradeWebSocket( res, req )
+        if err != nil {
+            return
+        }
+        defer conn.Close( CloseNormal, "" )
+        handler( conn, req )
+    })
+    // streams only handle their full path
+    return route.Exact()
+}
+
+// perform handshake, responds with an error status if `req` cannot be upgraded
+func upgradeWebSocket( res http.ResponseWriter, req *http.Request ) (conn *WebSocketConn, err error) {
+    key := req.Header.Get( "Sec-WebSocket-Key" )
+    switch {
+        case !headerHasToken( req.Header, "Connection", "upgrade" ) || !headerHasToken( req.Header, "Upgrade", "websocket" ):
+            err = errors.New( "websocket: upgrade required" )
+            res.Header().Set( "Upgrade", "websocket" )
+            Error( res, req, http.StatusUpgradeRequired, err )
+        case req.Header.Get( "Sec-WebSocket-Version" ) != "13":
+            err = errors.New( "websocket: unsupported version, use 13" )
+            res.Header().Set( "Sec-WebSocket-Version", "13" )
+            Error( res, req, http.StatusUpgradeRequired, err )
+        case !validWebSocketKey( key ):
+            err = errors.New( "websocket: invalid Sec-WebSocket-Key" )
+            Error( res, req, http.StatusBadRequest, err )
+        case !WebSocketCheckOrigin( req ):
+            err = fmt.Errorf( "websocket: origin %s not allowed", req.Header.Get( "Origin" ) )
+            Error( res, req, http.StatusForbidden, err )
+    }
+    if err != nil {
+        return
+    }
+
+    netConn, buffer, err := http.NewResponseController( res ).Hijack()
+    if err != nil {
+        Error( res, req, http.StatusInternalServerError, err )
+        return
+    }
+    // deadlines of the http server do not apply to long lived connections
+    netConn.SetDeadline( time.Time{} )
+
+    handshake := "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: " + webSocketAccept( key ) + "\r\n\r\n"
+    if _, err = buffer.WriteString( handshake ); err == nil {
+        err = buffer.Flush()
+    }
+    if err != nil {
+        netConn.Close()
+        return
+    }
+    conn = &WebSocketConn{ conn: netConn, reader: buffer.Reader }
+    return
+}
+
+// Open WebSocket connection to `rawUrl` (`ws`, `wss`, `http` or `https`), `res` is set when the server responded
+// Example:
+//     server := httptest.NewServer( app )
+//     conn, _, err := router.DialWebSocket( server.URL + "/live", nil )
+func DialWebSocket( rawUrl string, header http.Header ) (conn *WebSocketConn, res *http.Response, err error) {
+    wsUrl, err := url.Parse( rawUrl )
+    if err != nil {
+        return
+    }
+    secure := wsUrl.Scheme == "wss" || wsUrl.Scheme == "https"
+    address := wsUrl.Host
+    if wsUrl.Port() == "" {
+        if secure {
+            address = net.JoinHostPort( wsUrl.Hostname(), "443" )
+        } else {
+            address = net.JoinHostPort( wsUrl.Hostname(), "80" )
+        }
+    }
+
+    var netConn net.Conn
+    if secure {
+        wsUrl.Scheme = "https"
+        netConn, err = tls.Dial( "tcp", address, &tls.Config{ ServerName: wsUrl.Hostname() } )
+    } else {
+        wsUrl.Scheme = "http"
+        netConn, err = net.Dial( "tcp", address )
+    }
+    if err != nil {
+        return
+    }
+
+    nonce := make([]byte, 16)
+    rand.Read( nonce )
+    key := base64.StdEncoding.EncodeToString( nonce )
+    req, err := http.NewRequest( http.MethodGet, wsUrl.String(), nil )
+    if err != nil {
+        netConn.Close()
+        return
+    }
+    for name, values := range header {
+        req.Header[ name ] = values
+    }
+    req.Header.Set( "Connection", "Upgrade" )
+    req.Header.Set( "Upgrade", "websocket" )
+    req.Header.Set( "Sec-WebSocket-Key", key )
+    req.Header.Set( "Sec-WebSocket-Version", "13" )
+
+    reader := bufio.NewReader( netConn )
+    if err = req.Write( netConn ); err == nil {
+        res, err = http.ReadResponse( reader, req )
+    }
+    switch {
+        case err != nil:
+        case res.StatusCode != http.StatusSwitchingProtocols:
+            err = fmt.Errorf( "websocket: handshake failed with status %s", res.Status )
+        case res.Header.Get( "Sec-WebSocket-Accept" ) != webSocketAccept( key ):
+            err = errors.New( "websocket: handshake failed, invalid Sec-WebSocket-Accept" )
+    }
+    if err != nil {
+        netConn.Close()
+        return
+    }
+    conn = &WebSocketConn{ conn: netConn, reader: reader, client: true }
+    return
+}
+
+func webSocketAccept( key string ) string {
+    hash := sha1.Sum( []byte( key + webSocketGUID ) )
+    return base64.StdEncoding.EncodeToString( hash[:] )
+}
+
+func validWebSocketKey( key string ) bool {
+    nonce, err := base64.StdEncoding.DecodeString( key )
+    return err == nil && len( nonce ) == 16
+}
+
+// check comma separated header values for `token`, case insensitive
+func headerHasToken( header http.Header, name string, token string ) bool {
+    for _, value := range header.Values( name ) {
+        for _, field := range strings.Split( value, "," ) {
+            if strings.EqualFold( strings.TrimSpace( field ), token ) {
+                return true
+            }
+        }
+    }
+    return false
+}
+
+// Read next text or binary message, fragments are joined and pings answered.
+// Once a close frame is received it is answered and returned as `*WebSocketCloseError`
+func (conn *WebSocketConn) ReadMessage() (messageType int, data []byte, err error) {
+    for {
+        final, opcode, payload, frameErr := conn.readFrame()
+        if frameErr != nil {
+            return 0, nil, conn.fail( frameErr )
+        }
+        switch opcode {
+            case PingMessage:
+                if err = conn.writeFrame( PongMessage, payload ); err != nil {
+                    return 0, nil, err
+                }
+                continue
+            case PongMessage:
+                continue
+            case CloseMessage:
+                return 0, nil, conn.closeReceived( payload )
+            case continuationFrame:
+                if messageType == 0 {
+                    return 0, nil, conn.fail( &WebSocketCloseError{ CloseProtocolError, "unexpected continuation frame" } )
+                }
+            case TextMessage, BinaryMessage:
+                if messageType != 0 {
+                    return 0, nil, conn.fail( &WebSocketCloseError{ CloseProtocolError, "expected continuation frame" } )
+                }
+                messageType = opcode
+            default:
+                return 0, nil, conn.fail( &WebSocketCloseError{ CloseProtocolError, fmt.Sprintf( "unknown opcode %d", opcode ) } )
+        }
+
+        if len( data ) + len( payload ) > MaxWebSocketMessage {
+            return 0, nil, conn.fail( &WebSocketCloseError{ CloseMessageTooBig, "message too big" } )
+        }
+        data = append( data, payload... )
+        if final {
+            if messageType == TextMessage && !utf8.Valid( data ) {
+                return 0, nil, conn.fail( &WebSocketCloseError{ CloseInvalidPayload, "invalid utf-8" } )
+            }
+            return
+        }
+    }
+}
+
+func (conn *WebSocketConn) readFrame() (final bool, opcode int, payload []byte, err error) {
+    header := make([]byte, 2, 8)
+    if _, err = io.ReadFull( conn.reader, header ); err != nil {
+        return
+    }
+    final = header[0] & 0x80 != 0
+    opcode = int( header[0] & 0x0F )
+    masked := header[1] & 0x80 != 0
+    length := uint64( header[1] & 0x7F )
+
+    if header[0] & 0x70 != 0 {
+        err = &WebSocketCloseError{ CloseProtocolError, "reserved bits set" }
+        return
+    }
+    if masked == conn.client {
+        err = &WebSocketCloseError{ CloseProtocolError, "invalid masking" }
+        return
+    }
+    if opcode >= CloseMessage && ( !final || length > 125 ) {
+        err = &WebSocketCloseError{ CloseProtocolError, "invalid control frame" }
+        return
+    }
+
+    switch length {
+        case 126:
+            if _, err = io.ReadFull( conn.reader, header[:2] ); err != nil {
+                return
+            }
+            length = uint64( binary.BigEndian.Uint16( header[:2] ) )
+        case 127:
+            if _, err = io.ReadFull( conn.reader, header[:8] ); err != nil {
+                return
+            }
+            length = binary.BigEndian.Uint64( header[:8] )
+    }
+    if length > uint64( MaxWebSocketMessage ) {
+        err = &WebSocketCloseError{ CloseMessageTooBig, "message too big" }
+        return
+    }
+
+    var mask [4]byte
+    if masked {
+        if _, err = io.ReadFull( conn.reader, mask[:] ); err != nil {
+            return
+        }
+    }
+    payload = make([]byte, length)
+    if _, err = io.ReadFull( conn.reader, payload ); err != nil {
+        return
+    }
+    if masked {
+        for i := range payload {
+            payload[i] ^= mask[ i % 4 ]
+        }
+    }
+    return
+}
+
+// close connection after protocol violations or io errors, returns `err`
+func (conn *WebSocketConn) fail( err error ) error {
+    if closeErr, ok := err.(*WebSocketCloseError); ok {
+        conn.Close( closeErr.Code, closeErr.Reason )
+    } else {
+        conn.conn.Close()
+    }
+    return err
+}
+
+// answer close frame of peer and close connection
+func (conn *WebSocketConn) closeReceived( payload []byte ) error {
+    closeErr := &WebSocketCloseError{ Code: CloseNoStatus }
+    switch {
+        case len( payload ) == 1:
+            return conn.fail( &WebSocketCloseError{ CloseProtocolError, "invalid close frame" } )
+        case len( payload ) >= 2:
+            closeErr.Code = int( binary.BigEndian.Uint16( payload ) )
+            closeErr.Reason = string( payload[2:] )
+    }
+    conn.Close( closeErr.Code, "" )
+    return closeErr
+}
+
+// Send text or binary message
+func (conn *WebSocketConn) WriteMessage( messageType int, data []byte ) error {
+    if messageType != TextMessage && messageType != BinaryMessage {
+        return fmt.Errorf( "websocket: invalid message type %d", messageType )
+    }
+    return conn.writeFrame( messageType, data )
+}
+
+// Send `v` encoded as JSON text message
+func (conn *WebSocketConn) WriteJSON( v interface{} ) error {
+    data, err := json.Marshal( v )
+    if err != nil {
+        return err
+    }
+    return conn.writeFrame( TextMessage, data )
+}
+
+// Send ping, the answer is consumed by `ReadMessage`
+func (conn *WebSocketConn) Ping( data []byte ) error {
+    return conn.writeFrame( PingMessage, data )
+}
+
+// Send close frame unless already done and close the connection
+// Hint: `CloseNoStatus` sends an empty close frame
+func (conn *WebSocketConn) Close( code int, reason string ) error {
+    var payload []byte
+    if code != CloseNoStatus {
+        payload = binary.BigEndian.AppendUint16( nil, uint16( code ) )
+        payload = append( payload, reason... )
+    }
+    err := conn.writeFrame( CloseMessage, payload )
+    if err == ErrWebSocketClosed {
+        err = nil
+    }
+    if closeErr := conn.conn.Close(); err == nil && !errors.Is( closeErr, net.ErrClosed ) {
+        err = closeErr
+    }
+    return err
+}
+
+// Set deadline for reads and writes, i.e. to detect dead peers together with `Ping`
+func (conn *WebSocketConn) SetDeadline( deadline time.Time ) error {
+    return conn.conn.SetDeadline( deadline )
+}
+
+func (conn *WebSocketConn) writeFrame( opcode int, payload []byte ) error {
+    conn.writeMutex.Lock()
+    defer conn.writeMutex.Unlock()
+    if conn.closeSent {
+        return ErrWebSocketClosed
+    }
+    if opcode == CloseMessage {
+        conn.closeSent = true
+    }
+
+    frame := []byte{ 0x80 | byte( opcode ) }
+    length := len( payload )
+    var maskBit byte
+    if conn.client {
+        maskBit = 0x80
+    }
+    switch {
+        case length <= 125:
+            frame = append( frame, maskBit | byte( length ) )
+        case length <= 0xFFFF:
+            frame = append( frame, maskBit | 126 )
+            frame = binary.BigEndian.AppendUint16( frame, uint16( length ) )
+        default:
+            frame = append( frame, maskBit | 127 )
+            frame = binary.BigEndian.AppendUint64( frame, uint64( length ) )
+    }
+    if conn.client {
+        var mask [4]byte
+        rand.Read( mask[:] )
+        frame = append( frame, mask[:]... )
+        for i, b := range payload {
+            frame = append( frame, b ^ mask[ i % 4 ] )
+        }
+    } else {
+        frame = append( frame, payload... )
+    }
+    _, err := conn.conn.Write( frame )
+    return err
+}
@@ -0,0 +1,163 @@
+package router
+
+import (
+    "bytes"
+    "crypto/rand"
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+    "time"
+)
+
+// echo server, `close` makes the server close with `CloseGoingAway`; close frames received are reported on `closed`
+func webSocketServer( t *testing.T, closed chan *WebSocketCloseError ) *httptest.Server {
+    r := New( "/" )
+    r.WebSocket( "/echo", func( conn *WebSocketConn, req *http.Request ) {
+        for {
+            messageType, data, err := conn.ReadMessage()
+            var closeErr *WebSocketCloseError
+            if errors.As( err, &closeErr ) {
+                closed <- closeErr
+            }
+            if err != nil {
+                return
+            }
+            if string( data ) == "close" {
+                conn.Close( CloseGoingAway, "shutting down" )
+                return
+            }
+            conn.WriteMessage( messageType, data )
+        }
+    })
+    server := httptest.NewServer( r )
+    t.Cleanup( server.Close )
+    return server
+}
+
+func dialWebSocket( t *testing.T, server *httptest.Server ) *WebSocketConn {
+    conn, _, err := DialWebSocket( server.URL + "/echo", nil )
+    if err != nil {
+        t.Fatal( err )
+    }
+    conn.SetDeadline( time.Now().Add( 5 * time.Second ) )
+    t.Cleanup( func() { conn.conn.Close() } )
+    return conn
+}
+
+// write a single frame as is, `masked` like a client
+func writeRawFrame( t *testing.T, conn *WebSocketConn, final bool, opcode int, masked bool, payload []byte ) {
+    first := byte( opcode )
+    if final {
+        first |= 0x80
+    }
+    frame := []byte{ first }
+    if masked {
+        var mask [4]byte
+        rand.Read( mask[:] )
+        frame = append( frame, 0x80 | byte( len( payload ) ) )
+        frame = append( frame, mask[:]... )
+        for i, b := range payload {
+            frame = append( frame, b ^ mask[ i % 4 ] )
+        }
+    } else {
+        frame = append( frame, byte( len( payload ) ) )
+        frame = append( frame, payload... )
+    }
+    if _, err := conn.conn.Write( frame ); err != nil {
+        t.Fatal( err )
+    }
+}
+
+func TestWebSocketFragmentsAndPing( t *testing.T ) {
+    conn := dialWebSocket( t, webSocketServer( t, make(chan *WebSocketCloseError, 1) ) )
+
+    // control frames may be interleaved with fragments
+    writeRawFrame( t, conn, false, TextMessage, true, []byte( "Hel" ) )
+    writeRawFrame( t, conn, true, PingMessage, true, []byte( "are you there" ) )
+    writeRawFrame( t, conn, true, continuationFrame, true, []byte( "lo" ) )
+
+    final, opcode, payload, err := conn.readFrame()
+    if err != nil || !final || opcode != PongMessage || string( payload ) != "are you there" {
+        t.Fatalf( "pong: %v %d %q %v", final, opcode, payload, err )
+    }
+    messageType, data, err := conn.ReadMessage()
+    if err != nil || messageType != TextMessage || string( data ) != "Hello" {
+        t.Fatalf( "echo: %d %q %v", messageType, data, err )
+    }
+
+    // pongs are consumed by `ReadMessage`
+    if err := conn.Ping( []byte( "ping" ) ); err != nil {
+        t.Fatal( err )
+    }
+    // 16 and 64 bit payload lengths
+    for _, size := range []int{ 200, 70000 } {
+        sent := bytes.Repeat( []byte{ 0xAB }, size )
+        if err := conn.WriteMessage( BinaryMessage, sent ); err != nil {
+            t.Fatal( err )
+        }
+        messageType, data, err = conn.ReadMessage()
+        if err != nil || messageType != BinaryMessage || !bytes.Equal( data, sent ) {
+            t.Fatalf( "%d bytes: type %d, %d bytes, %v", size, messageType, len( data ), err )
+        }
+    }
+}
+
+func TestWebSocketClose( t *testing.T ) {
+    closed := make(chan *WebSocketCloseError, 1)
+    server := webSocketServer( t, closed )
+
+    // client initiated
+    conn := dialWebSocket( t, server )
+    if err := conn.Close( CloseNormal, "bye" ); err != nil {
+        t.Fatal( err )
+    }
+    select {
+        case closeErr := <-closed:
+            if closeErr.Code != CloseNormal || closeErr.Reason != "bye" {
+                t.Fatalf( "server received %+v", closeErr )
+            }
+        case <-time.After( 5 * time.Second ):
+            t.Fatal( "server did not receive close frame" )
+    }
+
+    // server initiated
+    conn = dialWebSocket( t, server )
+    conn.WriteMessage( TextMessage, []byte( "close" ) )
+    _, _, err := conn.ReadMessage()
+    var closeErr *WebSocketCloseError
+    if !errors.As( err, &closeErr ) || closeErr.Code != CloseGoingAway || closeErr.Reason != "shutting down" {
+        t.Fatalf( "client received %v", err )
+    }
+    if err := conn.WriteMessage( TextMessage, []byte( "late" ) ); err != ErrWebSocketClosed {
+        t.Fatalf( "write after close: %v", err )
+    }
+}
+
+func TestWebSocketProtocolError( t *testing.T ) {
+    closed := make(chan *WebSocketCloseError, 1)
+    conn := dialWebSocket( t, webSocketServer( t, closed ) )
+
+    // clients must mask their frames
+    writeRawFrame( t, conn, true, TextMessage, false, []byte( "unmasked" ) )
+    _, _, err := conn.ReadMessage()
+    var closeErr *WebSocketCloseError
+    if !errors.As( err, &closeErr ) || closeErr.Code != CloseProtocolError {
+        t.Fatalf( "client received %v", err )
+    }
+    if received := <-closed; received.Code != CloseProtocolError {
+        t.Fatalf( "server reported %+v", received )
+    }
+}
+
+func TestWebSocketRequiresUpgrade( t *testing.T ) {
+    server := webSocketServer( t, make(chan *WebSocketCloseError, 1) )
+    res, err := http.Get( server.URL + "/echo" )
+    if err != nil {
+        t.Fatal( err )
+    }
+    res.Body.Close()
+    if res.StatusCode != http.StatusUpgradeRequired {
+        t.Fatalf( "status %d", res.StatusCode )
+    }
+}
@@ -0,0 +1,111 @@
+/*
+    security headers - HSTS, nosniff, frame options, referrer policy and a `Content-Security-Policy` with per-request nonce
+
+    Use globally via `module.RegisterRequest( security.Strict )` or per router via `Headers.Middleware`,
+    views get the nonce as `{{.Nonce}}`, i.e. `<script nonce="{{.Nonce}}">`
+
+    (c)copyright 2021 by Gerald Wodni <gerald.wodni@gmail.com>
+*/
+package security
+
+import (
+    "context"
+    "crypto/rand"
+    "encoding/base64"
+    "fmt"
+    "net/http"
+    "strings"
+    "time"
+
+    "github.com/GeraldWodni/kern.go/router"
+)
+
+// Replaced by the request's nonce in `Headers.ContentSecurityPolicy`
+const NoncePlaceholder = "{nonce}"
+
+// Security headers set on every response, empty fields are omitted
+type Headers struct {
+    // `Strict-Transport-Security` max-age, only sent on https requests
+    HSTS time.Duration
+    HSTSIncludeSubdomains bool
+    HSTSPreload bool
+    // sends `X-Content-Type-Options: nosniff`
+    NoSniff bool
+    // `X-Frame-Options`, i.e. `DENY` or `SAMEORIGIN`; combine with CSP `frame-ancestors` for current browsers
+    FrameOptions string
+    ReferrerPolicy string
+    // may contain `NoncePlaceholder`, i.e. `script-src 'nonce-{nonce}'`
+    ContentSecurityPolicy string
+}
+
+// Strict defaults, scripts and inline styles need `nonce="{{.Nonce}}"`
+var Strict = &Headers{
+    HSTS: 365 * 24 * time.Hour,
+    HSTSIncludeSubdomains: true,
+    NoSniff: true,
+    FrameOptions: "DENY",
+    ReferrerPolicy: "strict-origin-when-cross-origin",
+    ContentSecurityPolicy: "default-src 'self'; script-src 'nonce-{nonce}' 'strict-dynamic'; style-src 'self' 'nonce-{nonce}'; " +
+        "img-src 'self' data:; object-src 'none'; base-uri 'none'; form-action 'self'; frame-ancestors 'none'",
+}
+
+type contextType int; const nonceContextId = contextType(42) // internal context key
+
+// get nonce of `req`, empty if no `Headers` are applied
+func Nonce( req *http.Request ) string {
+    nonce, _ := req.Context().Value( nonceContextId ).(string)
+    return nonce
+}
+
+func newNonce() string {
+    buffer := make([]byte, 16)
+    rand.Read( buffer )
+    return base64.RawURLEncoding.EncodeToString( buffer )
+}
+
+// https directly or via a proxy
+func secure( req *http.Request ) bool {
+    return req.TLS != nil || strings.EqualFold( req.Header.Get( "X-Forwarded-Proto" ), "https" )
+}
+
+// Set headers on `res`, returns `req` carrying the nonce
+func (headers *Headers) Apply( res http.ResponseWriter, req *http.Request ) *http.Request {
+    header := res.Header()
+    if headers.HSTS > 0 && secure( req ) {
+        hsts := fmt.Sprintf( "max-age=%d", int( headers.HSTS.Seconds() ) )
+        if headers.HSTSIncludeSubdomains {
+            hsts += "; includeSubDomains"
+        }
+        if headers.HSTSPreload {
+            hsts += "; preload"
+        }
+        header.Set( "Strict-Transport-Security", hsts )
+    }
+    if headers.NoSniff {
+        header.Set( "X-Content-Type-Options", "nosniff" )
+    }
+    if headers.FrameOptions != "" {
+        header.Set( "X-Frame-Options", headers.FrameOptions )
+    }
+    if headers.ReferrerPolicy != "" {
+        header.Set( "Referrer-Policy", headers.ReferrerPolicy )
+    }
+    if headers.ContentSecurityPolicy == "" {
+        return req
+    }
+    nonce := newNonce()
+    header.Set( "Content-Security-Policy", strings.ReplaceAll( headers.ContentSecurityPolicy, NoncePlaceholder, nonce ) )
+    return req.WithContext( context.WithValue( req.Context(), nonceContextId, nonce ) )
+}
+
+// Apply headers to all routes of a router, i.e. `app.Router.Use( security.Strict.Middleware )`
+func (headers *Headers) Middleware( res http.ResponseWriter, req *http.Request, next router.MiddlewareNext ) {
+    next( res, headers.Apply( res, req ) )
+}
+
+// implement module.Request interface to apply headers to all requests
+func (headers *Headers) StartRequest(res http.ResponseWriter, reqIn *http.Request) (reqOut *http.Request, ok bool) {
+    return headers.Apply( res, reqIn ), true
+}
+func (headers *Headers) EndRequest(res http.ResponseWriter, req *http.Request) {
+}
@@ -19,6 +19,8 @@ import (
     "github.com/GeraldWodni/kern.go/log"
     "github.com/GeraldWodni/kern.go/module"
     "github.com/GeraldWodni/kern.go/redis"
+    // registers its module first, so session log lines carry the request id
+    _ "github.com/GeraldWodni/kern.go/requestid"
 )
 
 type Session struct {
@@ -110,14 +112,14 @@ func (session *Session) keyName() string {
 func load( req *http.Request, session *Session ) {
     rdb, ok := redis.Of( req )
     if !ok {
-        log.Error( "Loading session failed: redis not in http.Request context, is the module loaded?" )
+        log.Of( req ).Error( "Loading session failed: redis not in http.Request context, is the module loaded?" )
         return
     }
 
     // TODO: export StringMap in redis/redis.go
     hash, err := redigo.StringMap( rdb.Do("HGETALL", session.keyName() ) )
     if err != nil {
-        log.Error( "Session load redis error:", err )
+        log.Of( req ).Error( "Session load redis error:", err )
         return
     }
 
@@ -129,18 +131,18 @@ func load( req *http.Request, session *Session ) {
             session.Username = value
             session.LoggedIn = value != ""
         } else {
-            log.Warningf( "Session unknown hash-key: \"%s\" (=\"%s\")", name, value )
+            log.Of( req ).Warningf( "Session unknown hash-key: \"%s\" (=\"%s\")", name, value )
         }
     }
 
     session.active = true
-    log.Infof( "Session loaded: %s (User: '%s')", session.Id, session.Username )
+    log.Of( req ).Infof( "Session loaded: %s (User: '%s')", session.Id, session.Username )
 }
 
 func save( req *http.Request, session *Session ) {
     rdb, ok := redis.Of( req )
     if !ok {
-        log.Error( "Saving session failed: redis not in http.Request context, is the module loaded?" )
+        log.Of( req ).Error( "Saving session failed: redis not in http.Request context, is the module loaded?" )
         return
     }
     args := make([]interface{}, 0)
@@ -156,23 +158,23 @@ func save( req *http.Request, session *Session ) {
     rdb.Send( "EXPIRE", session.keyName(), int(cookieTimeout.Seconds()) )
     rdb.Flush()
     if _, err := rdb.Receive(); err != nil {
-        log.Error( "Session save redis hash error:", err )
+        log.Of( req ).Error( "Session save redis hash error:", err )
     }
     if _, err := rdb.Receive(); err != nil {
-        log.Error( "Session save redis ttl error:", err )
+        log.Of( req ).Error( "Session save redis ttl error:", err )
     }
-    log.Infof( "Session saved: %s (User: '%s')", session.Id, session.Username )
+    log.Of( req ).Infof( "Session saved: %s (User: '%s')", session.Id, session.Username )
 }
 
 func destroy( req *http.Request, session *Session ) {
-    log.Info( "Destroying Session: ", session.Id )
+    log.Of( req ).Info( "Destroying Session: ", session.Id )
     rdb, ok := redis.Of( req )
     if !ok {
-        log.Error( "Destroying session failed: redis is not in http.Request context, is the module loaded?" )
+        log.Of( req ).Error( "Destroying session failed: redis is not in http.Request context, is the module loaded?" )
         return
     }
     if _, err := rdb.Do( "DEL", session.keyName() ); err != nil {
-        log.Error( "Session delete redis error:", err )
+        log.Of( req ).Error( "Session delete redis error:", err )
     }
 }
 
@@ -210,8 +212,9 @@ func init() {
 
 // get session for request-context
 // i.e. `session.Of( req ).Id`
+// Hint: `session` is nil if the module did not start for this request
 func Of( req *http.Request ) (session *Session, ok bool) {
-    session = req.Context().Value( contextId ).(*Session)
-    ok = session.active
+    session, _ = req.Context().Value( contextId ).(*Session)
+    ok = session != nil && session.active
     return
 }
@@ -0,0 +1,64 @@
+package session
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "strconv"
+    "testing"
+    "time"
+
+    "github.com/GeraldWodni/kern.go/module"
+    "github.com/GeraldWodni/kern.go/router"
+)
+
+// reports the session values seen when the request ends, like `save` does
+type endProbe struct {
+    path string
+    values chan int
+}
+
+func (probe *endProbe) StartRequest( res http.ResponseWriter, req *http.Request ) (*http.Request, bool) {
+    return req, true
+}
+func (probe *endProbe) EndRequest( res http.ResponseWriter, req *http.Request ) {
+    if session, ok := Of( req ); ok && req.URL.Path == probe.path {
+        count := 0
+        for range session.Values {
+            count++
+        }
+        probe.values <- count
+    }
+}
+
+// modules are global, register once for `-count`
+var probe = &endProbe{ path: "/slow", values: make(chan int, 1) }
+func init() {
+    module.RegisterRequest( probe )
+}
+
+// handlers overrunning their timeout keep their session until they return, run with `-race`
+func TestSessionWrittenAfterTimeout( t *testing.T ) {
+    r := router.New( "/" )
+    r.Get( "/slow", func( res http.ResponseWriter, req *http.Request, next router.RouteNext ) {
+        session := New( res, req )
+        <-req.Context().Done()
+        for i := 0; i < 100; i++ {
+            session.Values[ strconv.Itoa( i ) ] = "late"
+            time.Sleep( 100 * time.Microsecond )
+        }
+    }).Timeout( 10 * time.Millisecond )
+
+    res := httptest.NewRecorder()
+    r.ServeHTTP( res, httptest.NewRequest( http.MethodGet, "/slow", nil ) )
+    if res.Code != router.TimeoutStatus {
+        t.Fatalf( "status %d", res.Code )
+    }
+    select {
+        case count := <-probe.values:
+            if count != 100 {
+                t.Fatalf( "request ended with %d of 100 values written", count )
+            }
+        case <-time.After( 5 * time.Second ):
+            t.Fatal( "request did not end" )
+    }
+}
@@ -0,0 +1,52 @@
+/*
+    Error pages - `errors/<status>.gohtml` looked up through the hierarchy, `errors/default.gohtml` as fallback
+
+    (c)copyright 2021 by Gerald Wodni <gerald.wodni@gmail.com>
+*/
+package view
+
+import (
+    "fmt"
+    "net/http"
+
+    "github.com/GeraldWodni/kern.go/hierarchy"
+    "github.com/GeraldWodni/kern.go/router"
+)
+
+// Locals passed to error views
+type ErrorLocals struct {
+    Status int
+    StatusText string
+    Message string
+    RequestId string
+    // only set in `router.Development` mode
+    Stack string
+}
+
+// Creates a `router.ErrorHandler` which renders `errors/<status>.gohtml` found in `h`, i.e. `errors/404.gohtml`
+// Hint: views are loaded upon first use and kept for later requests
+func ErrorHandler( h *hierarchy.Hierarchy ) router.ErrorHandler {
+    views := newHierarchyViews( h )
+
+    return func( res http.ResponseWriter, req *http.Request, status int, err error ) {
+        view, lookupErr := views.lookup( fmt.Sprintf( "errors/%d.gohtml", status ), "errors/default.gohtml" )
+        if lookupErr != nil {
+            router.ErrReq( res, req, lookupErr )
+            return
+        }
+
+        locals := ErrorLocals{
+            Status: status,
+            StatusText: http.StatusText( status ),
+            Message: router.ErrorMessage( status, err ),
+            RequestId: router.RequestId( req ),
+        }
+        if panicErr, ok := err.(*router.PanicError); ok && router.Development {
+            locals.Stack = string( panicErr.Stack )
+        }
+
+        res.Header().Set( "Content-Type", view.ContentType )
+        res.WriteHeader( status )
+        view.Render( res, req, nil, locals )
+    }
+}
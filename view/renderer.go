@@ -0,0 +1,103 @@
+/*
+    Renderer - views looked up by name through the hierarchy, used by `router.Resource`, `login` and `logout`
+
+    (c)copyright 2021 by Gerald Wodni <gerald.wodni@gmail.com>
+*/
+package view
+
+import (
+    "fmt"
+    "net/http"
+    "strings"
+    "sync"
+
+    "github.com/GeraldWodni/kern.go/hierarchy"
+    "github.com/GeraldWodni/kern.go/router"
+)
+
+// views found in a hierarchy, loaded upon first use and kept for later requests
+type hierarchyViews struct {
+    h *hierarchy.Hierarchy
+    views map[string]*HtmlView
+    mutex sync.Mutex
+}
+
+func newHierarchyViews( h *hierarchy.Hierarchy ) *hierarchyViews {
+    return &hierarchyViews{
+        h: h,
+        views: make(map[string]*HtmlView),
+    }
+}
+
+// get first of `names` found in `views/`
+func (hv *hierarchyViews) lookup( names ...string ) (view *HtmlView, err error) {
+    for _, name := range names {
+        if filename, ok := hv.h.Lookup( "views", name ); ok {
+            return hv.load( filename, func() (*HtmlView, error) {
+                return NewHtml( filename )
+            })
+        }
+        if fsys, fsName, ok := hv.h.Find( "views", name ); ok {
+            return hv.load( "fallback:" + fsName, func() (*HtmlView, error) {
+                return NewHtmlFS( fsys, fsName )
+            })
+        }
+    }
+    err = fmt.Errorf( "view: none of %s found", strings.Join( names, ", " ) )
+    return
+}
+
+// get cached view or create it
+func (hv *hierarchyViews) load( key string, create func() (*HtmlView, error) ) (view *HtmlView, err error) {
+    hv.mutex.Lock()
+    defer hv.mutex.Unlock()
+    if view, ok := hv.views[ key ]; ok {
+        return view, nil
+    }
+    if view, err = create(); err == nil {
+        hv.views[ key ] = view
+    }
+    return
+}
+
+// Creates a new `View` from `views/<name>` found in `h`, i.e. `view.NewHtmlHierarchy( hierarchy.Default, "index.gohtml" )`
+// Hint: files on disk are watched, embedded ones are not
+func NewHtmlHierarchy( h *hierarchy.Hierarchy, name string ) (view *HtmlView, err error) {
+    if filename, ok := h.Lookup( "views", name ); ok {
+        return NewHtml( filename )
+    }
+    fsys, fsName, ok := h.Find( "views", name )
+    if !ok {
+        return nil, fmt.Errorf( "view: %s not found", name )
+    }
+    return NewHtmlFS( fsys, fsName )
+}
+
+// Creates a `router.Renderer` which renders `<name>.gohtml` found in `h`, i.e. `items/index.gohtml`
+// Hint: set as `Router.Renderer` for `router.Resource` controllers
+func Renderer( h *hierarchy.Hierarchy ) router.Renderer {
+    views := newHierarchyViews( h )
+    return func( res http.ResponseWriter, req *http.Request, status int, name string, locals interface{} ) {
+        view, err := views.lookup( name + ".gohtml" )
+        if err != nil {
+            router.Error( res, req, http.StatusInternalServerError, err )
+            return
+        }
+        res.Header().Set( "Content-Type", view.ContentType )
+        res.WriteHeader( status )
+        view.Render( res, req, nil, locals )
+    }
+}
+
+// renders views of `hierarchy.Default` for routers without a `Renderer`
+var defaultRenderer = Renderer( hierarchy.Default )
+
+// Render `<name>.gohtml` via the `Renderer` of the router serving `req`, so each website uses its own hierarchy
+// Hint: falls back to `hierarchy.Default`, used by modules like `login` which are shared between websites
+func RenderNamed( res http.ResponseWriter, req *http.Request, status int, name string, locals interface{} ) {
+    renderer := router.RendererOf( req )
+    if renderer == nil {
+        renderer = defaultRenderer
+    }
+    renderer( res, req, status, name, locals )
+}
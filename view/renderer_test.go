@@ -0,0 +1,50 @@
+package view
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "testing"
+
+    "github.com/GeraldWodni/kern.go/hierarchy"
+    "github.com/GeraldWodni/kern.go/router"
+)
+
+// hierarchy with a single `views/greeting.gohtml` rendering `text`
+func greetingHierarchy( t *testing.T, text string ) *hierarchy.Hierarchy {
+    prefix := t.TempDir()
+    if err := os.Mkdir( filepath.Join( prefix, "views" ), 0755 ); err != nil {
+        t.Fatal( err )
+    }
+    layout := `{{define "layout"}}` + text + ` {{.Locals}}{{end}}`
+    if err := os.WriteFile( filepath.Join( prefix, "views", "greeting.gohtml" ), []byte( layout ), 0644 ); err != nil {
+        t.Fatal( err )
+    }
+    return &hierarchy.Hierarchy{ Prefixes: []string{ prefix } }
+}
+
+// modules shared between websites render the view of the website serving the request
+func TestRenderNamedPerWebsite( t *testing.T ) {
+    greet := func( res http.ResponseWriter, req *http.Request, next router.RouteNext ) {
+        RenderNamed( res, req, http.StatusOK, "greeting", "visitor" )
+    }
+    shop := router.New( "/" )
+    shop.Renderer = Renderer( greetingHierarchy( t, "shop" ) )
+    shop.Get( "/", greet )
+    blog := router.New( "/" )
+    blog.Renderer = Renderer( greetingHierarchy( t, "blog" ) )
+    blog.Get( "/", greet )
+
+    for _, c := range []struct{ router *router.Router; expected string }{
+        { shop, "shop visitor" },
+        { blog, "blog visitor" },
+        { shop, "shop visitor" },
+    } {
+        res := httptest.NewRecorder()
+        c.router.ServeHTTP( res, httptest.NewRequest( http.MethodGet, "/", nil ) )
+        if body := res.Body.String(); res.Code != http.StatusOK || body != c.expected {
+            t.Errorf( "status %d, body %q, expected %q", res.Code, body, c.expected )
+        }
+    }
+}
@@ -1,14 +1,18 @@
 /*
     Provides a wrapper class around `html.template`.
-    Loaded templates are kept in cache but watched with `fsnotify` which invalidates the cache and forces a read on the next `Render`
+    Loaded templates are kept in cache but watched with `fsnotify` which invalidates the cache and forces a read on the next `Render`,
+    embedded templates (see `NewHtmlFS`) never change and are not watched
 
     (c)copyright 2021 by Gerald Wodni <gerald.wodni@gmail.com>
 */
 package view
 
 import (
+    "context"
     "errors"
+    "fmt"
     "io"
+    "io/fs"
     htmlTemplate "html/template"
     textTemplate "text/template"
     "net/http"
@@ -22,6 +26,7 @@ import (
 
     "github.com/GeraldWodni/kern.go/log"
     "github.com/GeraldWodni/kern.go/router"
+    "github.com/GeraldWodni/kern.go/security"
 )
 
 type InterfaceMap map[string]interface{}
@@ -35,6 +40,37 @@ type Message struct {
 // Available to all templates, i.e. `{{.Globals.FooBar}}
 var Globals = make(InterfaceMap)
 
+type contextType int; const globalsContextId = contextType(42) // internal context key
+
+// Middleware exposing `globals` on top of `Globals` to all views rendered below a router, i.e. per website
+func GlobalsMiddleware( globals InterfaceMap ) router.Middleware {
+    return func( res http.ResponseWriter, req *http.Request, next router.MiddlewareNext ) {
+        next( res, WithGlobals( req, globals ) )
+    }
+}
+
+// Expose `globals` on top of `Globals` to all views rendered for `req`
+// Hint: used by kern's website dispatch, so error pages of the website see them as well
+func WithGlobals( req *http.Request, globals InterfaceMap ) *http.Request {
+    return req.WithContext( context.WithValue( req.Context(), globalsContextId, globals ) )
+}
+
+// get `Globals` merged with those of `GlobalsMiddleware`
+func globalsOf( req *http.Request ) InterfaceMap {
+    globals, ok := req.Context().Value( globalsContextId ).(InterfaceMap)
+    if !ok || len( globals ) == 0 {
+        return Globals
+    }
+    merged := make(InterfaceMap)
+    for name, value := range Globals {
+        merged[ name ] = value
+    }
+    for name, value := range globals {
+        merged[ name ] = value
+    }
+    return merged
+}
+
 // Environment
 const envViewPrefix = "KERN_VIEW_"
 var envValues = make(InterfaceMap)
@@ -62,6 +98,11 @@ var funcs = FuncMap{
     },
     "ToUpper": strings.ToUpper,
     "ToLower": strings.ToLower,
+    // reverse routing via `router.URLFor`, parameters are passed as name-value pairs, i.e. `{{url "item" "id" .Locals.Id}}`
+    // Hint: replaced per request by `Render`, names are resolved through the router serving the request
+    "url": func( name string, pairs ...interface{} ) (string, error) {
+        return "", fmt.Errorf( "url: route '%s' can only be resolved while rendering via View.Render", name )
+    },
 }
 
 type View struct {
@@ -70,6 +111,10 @@ type View struct {
     TemplateName string
     reloadRequiredMutex *sync.Mutex
     ContentType string
+    // `Filenames` are relative to `fsys` instead of the working directory
+    fsys fs.FS
+    // idle `boundTemplate`s, clones are bound to one request at a time
+    bound *sync.Pool
 }
 
 type ViewTemplate interface {
@@ -79,8 +124,11 @@ type ViewTemplate interface {
 type ViewInterface interface {
     Render( http.ResponseWriter, *http.Request, router.RouteNext, interface{} )
     getTemplate() ViewTemplate
+    defines( name string ) bool
     getView() *View
     loadTemplate() error
+    // clone of the parsed template using `url` for the `url` function
+    clone( url urlFunc ) (ViewTemplate, error)
 }
 
 
@@ -128,12 +176,30 @@ func NewHtml( filenames ...string ) (view *HtmlView, err error) {
             TemplateName: "layout",
             ReloadRequired: false,
             reloadRequiredMutex: &sync.Mutex{},
+            bound: &sync.Pool{},
         },
         Template: nil,
     }
     err = loadAndWatch( view )
     return
 }
+// Creates a new `View` from `names` of `fsys`, i.e. `view.NewHtmlFS( hierarchy.Embedded, "views/login.gohtml" )`
+func NewHtmlFS( fsys fs.FS, names ...string ) (view *HtmlView, err error) {
+    view = &HtmlView {
+        View: View {
+            ContentType: "text/html; charset=utf-8",
+            Filenames: names,
+            TemplateName: "layout",
+            ReloadRequired: false,
+            reloadRequiredMutex: &sync.Mutex{},
+            bound: &sync.Pool{},
+            fsys: fsys,
+        },
+        Template: nil,
+    }
+    err = view.loadTemplate()
+    return
+}
 func NewText( contentType string, filenames ...string ) (view *TextView, err error) {
     view = &TextView {
         View: View {
@@ -142,6 +208,7 @@ func NewText( contentType string, filenames ...string ) (view *TextView, err err
             TemplateName: "",
             ReloadRequired: false,
             reloadRequiredMutex: &sync.Mutex{},
+            bound: &sync.Pool{},
         },
         Template: nil,
     }
@@ -181,11 +248,21 @@ func NewCssHandler( filenames ...string ) ( routeHandler router.RouteHandler ) {
 }
 
 func (view *HtmlView) loadTemplate() (err error) {
-    view.Template, err = htmlTemplate.New( path.Base(view.Filenames[0]) ).Funcs( htmlFuncMap ).ParseFiles( view.Filenames... )
+    template := htmlTemplate.New( path.Base(view.Filenames[0]) ).Funcs( htmlFuncMap )
+    if view.fsys != nil {
+        view.Template, err = template.ParseFS( view.fsys, view.Filenames... )
+    } else {
+        view.Template, err = template.ParseFiles( view.Filenames... )
+    }
     return
 }
 func (view *TextView) loadTemplate() (err error) {
-    view.Template, err = textTemplate.New( path.Base(view.Filenames[0]) ).Funcs( textFuncMap ).ParseFiles( view.Filenames... )
+    template := textTemplate.New( path.Base(view.Filenames[0]) ).Funcs( textFuncMap )
+    if view.fsys != nil {
+        view.Template, err = template.ParseFS( view.fsys, view.Filenames... )
+    } else {
+        view.Template, err = template.ParseFiles( view.Filenames... )
+    }
     return
 }
 func (view *HtmlView) getView() *View {
@@ -194,6 +271,26 @@ func (view *HtmlView) getView() *View {
 func (view *TextView) getView() *View {
     return &view.View
 }
+func (view *HtmlView) defines( name string ) bool {
+    return view.Template.Lookup( name ) != nil
+}
+func (view *TextView) defines( name string ) bool {
+    return view.Template.Lookup( name ) != nil
+}
+func (view *HtmlView) clone( url urlFunc ) (ViewTemplate, error) {
+    clone, err := view.Template.Clone()
+    if err != nil {
+        return nil, err
+    }
+    return clone.Funcs( htmlTemplate.FuncMap{ "url": url } ), nil
+}
+func (view *TextView) clone( url urlFunc ) (ViewTemplate, error) {
+    clone, err := view.Template.Clone()
+    if err != nil {
+        return nil, err
+    }
+    return clone.Funcs( textTemplate.FuncMap{ "url": url } ), nil
+}
 func (view *HtmlView) getTemplate() ViewTemplate {
     return view.Template
 }
@@ -245,6 +342,46 @@ func loadAndWatch( viewInterface ViewInterface ) (err error) {
     return
 }
 
+type urlFunc func( name string, pairs ...interface{} ) (string, error)
+
+// clone of a view's template whose `url` function resolves names through the router serving `req`
+// Hint: `html/template` cannot clone executed templates, so `Template` itself is never executed
+type boundTemplate struct {
+    source ViewTemplate
+    template ViewTemplate
+    req *http.Request
+}
+
+// get idle clone of the current template or create one, `release` it after rendering
+func bind( viewInterface ViewInterface, req *http.Request ) (bound *boundTemplate, err error) {
+    view := viewInterface.getView()
+    source := viewInterface.getTemplate()
+    // clones of templates replaced by a reload are dropped
+    if idle, ok := view.bound.Get().(*boundTemplate); ok && idle.source == source {
+        idle.req = req
+        return idle, nil
+    }
+    bound = &boundTemplate{ source: source, req: req }
+    bound.template, err = viewInterface.clone( bound.url )
+    return
+}
+
+func (bound *boundTemplate) release( view *View ) {
+    bound.req = nil
+    view.bound.Put( bound )
+}
+
+func (bound *boundTemplate) url( name string, pairs ...interface{} ) (string, error) {
+    if len( pairs ) % 2 != 0 {
+        return "", fmt.Errorf( "url: odd number of parameters for route '%s'", name )
+    }
+    params := router.Params{}
+    for i := 0; i < len( pairs ); i += 2 {
+        params[ fmt.Sprint( pairs[i] ) ] = fmt.Sprint( pairs[i+1] )
+    }
+    return router.URLFor( bound.req, name, params )
+}
+
 // Render view using `Globals` as well as values passed via `locals`
 func (view *HtmlView) Render( res http.ResponseWriter, req *http.Request, next router.RouteNext, locals interface{} ) {
     render( view, res, req, next, locals )
@@ -254,9 +391,8 @@ func (view *TextView) Render( res http.ResponseWriter, req *http.Request, next r
 }
 // TODO: figure out if there is a way to mount this function directly onto the type
 func render( viewInterface ViewInterface, res http.ResponseWriter, req *http.Request, next router.RouteNext, locals interface{} ) {
-    template := viewInterface.getTemplate()
-    if template == nil {
-        router.Err( res, errors.New( "View.Template is nil, check log for previous Errors" ) )
+    if viewInterface.getTemplate() == nil {
+        router.ErrReq( res, req, errors.New( "View.Template is nil, check log for previous Errors" ) )
         return
     }
 
@@ -266,14 +402,19 @@ func render( viewInterface ViewInterface, res http.ResponseWriter, req *http.Req
     defer view.reloadRequiredMutex.Unlock()
     if view.ReloadRequired {
         view.ReloadRequired = false
-        log.Infof( "Reloading View: %s", view.Filenames[0] )
+        log.Of( req ).Infof( "Reloading View: %s", view.Filenames[0] )
         err := loadAndWatch( viewInterface )
         if err != nil {
-            router.Err( res, err )
+            router.ErrReq( res, req, err )
             return
         }
-        template = viewInterface.getTemplate()
     }
+    bound, err := bind( viewInterface, req )
+    if err != nil {
+        router.ErrReq( res, req, err )
+        return
+    }
+    defer bound.release( view )
 
     hostname, _, _ := strings.Cut( req.Host, ":" )
     now := time.Now().UTC()
@@ -282,26 +423,32 @@ func render( viewInterface ViewInterface, res http.ResponseWriter, req *http.Req
         Env InterfaceMap
         Locals interface{}
         Hostname string
+        // see `requestid` module
+        RequestId string
+        // for inline scripts and styles, see `security` module
+        Nonce string
         Now time.Time
         NowISO string
     }{
-        Globals: Globals,
+        Globals: globalsOf( req ),
         Env: envValues,
         Locals: locals,
         Hostname: hostname,
+        RequestId: router.RequestId( req ),
+        Nonce: security.Nonce( req ),
         Now: now,
         NowISO: now.Format("2006-01-02 15:04:05"),
     }
 
     res.Header().Set( "Content-Type", view.ContentType )
-    var err error
-    if view.TemplateName == "" {
-        err = template.Execute( res, data )
+    // standalone templates without `TemplateName` (i.e. `layout`) are executed directly
+    if view.TemplateName == "" || !viewInterface.defines( view.TemplateName ) {
+        err = bound.template.Execute( res, data )
     } else {
-        err = template.ExecuteTemplate( res, "layout", data )
+        err = bound.template.ExecuteTemplate( res, view.TemplateName, data )
     }
     if err != nil {
-        log.Error( "View.Render", err )
+        log.Of( req ).Error( "View.Render", err )
     }
 }
 
@@ -0,0 +1,42 @@
+package view
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "testing"
+    "testing/fstest"
+
+    "github.com/GeraldWodni/kern.go/router"
+)
+
+// one view shared by two websites renders each website's route
+func TestURLResolvedPerRequest( t *testing.T ) {
+    fsys := fstest.MapFS{
+        "item.gohtml": &fstest.MapFile{ Data: []byte( `{{define "layout"}}{{url "item" "id" "7"}}{{end}}` ) },
+    }
+    itemView, err := NewHtmlFS( fsys, "item.gohtml" )
+    if err != nil {
+        t.Fatal( err )
+    }
+    render := func( res http.ResponseWriter, req *http.Request, next router.RouteNext ) {
+        itemView.Render( res, req, next, nil )
+    }
+
+    shop := router.New( "/" )
+    shop.Get( "/shop/item/:id", render ).Name( "item" )
+    blog := router.New( "/" )
+    blog.Get( "/posts/:id", render ).Name( "item" )
+
+    for i := 0; i < 2; i++ {
+        for _, c := range []struct{ router *router.Router; path, expected string }{
+            { shop, "/shop/item/1", "/shop/item/7" },
+            { blog, "/posts/1", "/posts/7" },
+        } {
+            res := httptest.NewRecorder()
+            c.router.ServeHTTP( res, httptest.NewRequest( http.MethodGet, c.path, nil ) )
+            if body := res.Body.String(); body != c.expected {
+                t.Errorf( "%s: %q, expected %q", c.path, body, c.expected )
+            }
+        }
+    }
+}
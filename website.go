@@ -0,0 +1,87 @@
+/*
+    virtual hosting - serve several websites from one kern instance, keyed by hostname
+
+    (c)copyright 2021 by Gerald Wodni <gerald.wodni@gmail.com>
+*/
+package kern
+
+import (
+    "net/http"
+    "strings"
+
+    "github.com/GeraldWodni/kern.go/hierarchy"
+    "github.com/GeraldWodni/kern.go/log"
+    "github.com/GeraldWodni/kern.go/router"
+    "github.com/GeraldWodni/kern.go/view"
+)
+
+type Website struct {
+    // exact hostname `example.com` or wildcard subdomain `*.example.com`
+    Host string
+    Router *router.Router
+    Hierarchy *hierarchy.Hierarchy
+    // available to all views of this website, overrides `view.Globals`
+    Globals view.InterfaceMap
+}
+
+// Add website served for `host`, either exact `example.com` or any subdomain `*.example.com`.
+// `hierarchyPrefixes` default to `websites/<host>`, i.e. views are looked up in `websites/example.com/views`
+// Hint: hosts without a matching website are served by `kern.Router`
+func (kern *Kern) AddWebsite( host string, hierarchyPrefixes []string ) (website *Website) {
+    host = strings.ToLower( host )
+    if len( hierarchyPrefixes ) == 0 {
+        hierarchyPrefixes = []string{ "websites/" + host }
+    }
+
+    hierarchyInstance, err := hierarchy.New( hierarchyPrefixes )
+    if err != nil {
+        log.Fatal( err )
+    }
+
+    website = &Website{
+        Host: host,
+        Router: newRouter( host, hierarchyInstance ),
+        Hierarchy: hierarchyInstance,
+        Globals: make(view.InterfaceMap),
+    }
+
+    if _, exists := kern.Websites[ host ]; exists {
+        log.Warningf( "kern.AddWebsite: host '%s' already exists, overwriting", host )
+    }
+    kern.Websites[ host ] = website
+    log.Infof( "kern website added: %s", host )
+    return
+}
+
+// Find website for `host`: exact match first, then the most specific wildcard
+func (kern *Kern) Website( host string ) (website *Website, ok bool) {
+    if hostname, _, found := strings.Cut( host, ":" ); found {
+        host = hostname
+    }
+    host = strings.ToLower( host )
+
+    if website, ok = kern.Websites[ host ]; ok {
+        return
+    }
+    for pattern, candidate := range kern.Websites {
+        suffix, isWildcard := strings.CutPrefix( pattern, "*" )
+        if !isWildcard || !strings.HasSuffix( host, suffix ) || len( host ) == len( suffix ) {
+            continue
+        }
+        if website == nil || len( pattern ) > len( website.Host ) {
+            website = candidate
+        }
+    }
+    ok = website != nil
+    return
+}
+
+// Dispatch `req` to the website matching `req.Host`, falls back to `kern.Router`
+// Hint: the website's `Globals` are set before routing, so they reach all of its views including error pages
+func (kern *Kern) ServeHTTP( res http.ResponseWriter, req *http.Request ) {
+    if website, ok := kern.Website( req.Host ); ok {
+        website.Router.ServeHTTP( res, view.WithGlobals( req, website.Globals ) )
+        return
+    }
+    kern.Router.ServeHTTP( res, req )
+}
@@ -0,0 +1,45 @@
+package kern
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "testing"
+
+    "github.com/GeraldWodni/kern.go/router"
+)
+
+// error pages of a website render with its `Globals`, even after a panic
+func TestWebsiteGlobalsOnErrorPages( t *testing.T ) {
+    prefix := t.TempDir()
+    if err := os.MkdirAll( filepath.Join( prefix, "views", "errors" ), 0755 ); err != nil {
+        t.Fatal( err )
+    }
+    layout := `{{define "layout"}}{{.Globals.Brand}} {{.Locals.Status}}{{end}}`
+    for _, name := range []string{ "404.gohtml", "500.gohtml" } {
+        if err := os.WriteFile( filepath.Join( prefix, "views", "errors", name ), []byte( layout ), 0644 ); err != nil {
+            t.Fatal( err )
+        }
+    }
+
+    kern := New( ":0", []string{} )
+    website := kern.AddWebsite( "shop.example.com", []string{ prefix } )
+    website.Globals[ "Brand" ] = "Shop"
+    website.Router.Get( "/panic", func( res http.ResponseWriter, req *http.Request, next router.RouteNext ) {
+        panic( "boom" )
+    })
+
+    for _, c := range []struct{ path string; status int; body string }{
+        { "/missing", http.StatusNotFound, "Shop 404" },
+        { "/panic", http.StatusInternalServerError, "Shop 500" },
+    } {
+        req := httptest.NewRequest( http.MethodGet, c.path, nil )
+        req.Host = "shop.example.com"
+        res := httptest.NewRecorder()
+        kern.ServeHTTP( res, req )
+        if res.Code != c.status || res.Body.String() != c.body {
+            t.Errorf( "%s: status %d, body %q, expected %q", c.path, res.Code, res.Body.String(), c.body )
+        }
+    }
+}